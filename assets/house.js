@@ -115,6 +115,18 @@ function onOpen(event) {
 function onMessage(event) {
   var msg = JSON.parse(event.data);
   console.log("Msg: ", msg);
+  if (msg.Removed != null) {
+    removeDevice(msg.Removed);
+    return;
+  }
+  if (msg.Failed != null) {
+    commandFailed(msg.Failed, msg.Error);
+    return;
+  }
+  if (msg.Occupancy != null) {
+    updateOccupancy(msg.Occupancy);
+    return;
+  }
   updateDevice(msg);
 }
 function onClose(event) {
@@ -141,13 +153,16 @@ function onClose(event) {
 
 // updateDevice is called on a message from network.
 function updateDevice(msg) {
+  if (msg.Thermostat == null && msg.Portal == null && msg.Switch == null) {
+    return; // Nothing to draw, motion sensors show up as room occupancy.
+  }
   var prefix = "td";
   if (msg.Portal != null) {
     prefix = "pt";
   } else if (msg.Switch != null) {
     prefix = "sw"
   }
-  var id = prefix + msg.Name.replace(/\s/g, "");
+  var id = prefix + msg.ID;
   var device = devices[id];
 
   if (device == null || device == undefined) {
@@ -163,11 +178,68 @@ function updateDevice(msg) {
       createSwitch(device);
     }
   }
+  // Fade out devices we haven't heard from in a while.
+  if (msg.Online) {
+    device.itemEle.setAttribute("opacity", "1.0");
+  } else {
+    device.itemEle.setAttribute("opacity", "0.4");
+  }
+  // Device name is only a label, it can be renamed at any time.
+  device.name = msg.Name;
+  device.itemEle.childNodes[0].textContent = msg.Name;
   // Now cause device to re-render with new data.
   device.update(msg);
   device.msg = msg;
 }
 
+// commandFailed is called when a device never acknowledged a change we requested.
+function commandFailed(devID, err) {
+  var name = devID;
+  for (var id in devices) {
+    if (devices[id].id == devID) {
+      name = devices[id].name;
+      devices[id].update(devices[id].msg); // Re-render with the last known state.
+    }
+  }
+  alert(name + ": " + err);
+}
+
+// occupiedMinutes is how recent motion in a room has to be for it to show as occupied.
+var occupiedMinutes = 30;
+var lastOccupancy = null;
+
+// Rooms stop being occupied without any new message, so re-check every minute.
+setInterval(function() {
+  if (lastOccupancy != null) {
+    updateOccupancy(lastOccupancy);
+  }
+}, 60000);
+
+// updateOccupancy highlights the rooms that have seen motion recently.
+function updateOccupancy(occ) {
+  lastOccupancy = occ;
+  var since = Date.now()/1000 - occupiedMinutes*60;
+  var rooms = document.getElementsByClassName("room");
+  for (var i = 0; i < rooms.length; i++) {
+    var motion = occ.Rooms == null ? 0 : occ.Rooms[rooms[i].id];
+    if (motion != undefined && motion > since) {
+      rooms[i].classList.add("occupied");
+    } else {
+      rooms[i].classList.remove("occupied");
+    }
+  }
+}
+
+// removeDevice is called when the server no longer tracks a device.
+function removeDevice(devID) {
+  for (var id in devices) {
+    if (devices[id].id == devID) {
+      devices[id].itemEle.remove();
+      delete devices[id];
+    }
+  }
+}
+
 // createDevice is generic function to create a new device.
 function createDevice(id, msg) {
   var tmpl = "thermoTemplate";
@@ -189,6 +261,7 @@ function createDevice(id, msg) {
     attached.parentElement.parentElement.appendChild(itemEle);
   }
   device.itemEle = itemEle;
+  device.id = msg.ID;
   device.name = msg.Name;
   device.msg = msg;
   devices[id] = device;
@@ -196,6 +269,9 @@ function createDevice(id, msg) {
   return device;
 }
 
+// thermoFaults describes the refuge.Fault a thermostat reports.
+var thermoFaults = ["", "Failsafe: no temp readings", "Failsafe: freeze protection", "Failsafe: over temp"];
+
 // createX functions create the control specific dom elements and interaction handlers.
 function createThermostat(device) {
   var thermoControl = null;
@@ -231,6 +307,25 @@ function createThermostat(device) {
   thermoInteraction(device); // Add thermo controls UI
 
   var devdom = device.itemEle.childNodes[4];
+  // Calibrate by entering what the temp actually is, the offset is worked out from the latest raw reading.
+  devdom.querySelector(".sensor").addEventListener("click", function(e) {
+    e.stopPropagation();
+    if (editing || !device.msg) {
+      return;
+    }
+    var actual = parseFloat(prompt("What is the temperature actually (" + units + ")?"));
+    if (isNaN(actual)) {
+      return;
+    }
+    if (units == "F") {
+      actual = convertToC(actual);
+    }
+    var cal = device.msg.Thermometer.Calibration;
+    var offset = actual - device.msg.Thermometer.RawTemp * (cal.TempScale || 1);
+    var msg = JSON.stringify({ID: device.id, Calibration: {TempOffset: offset, TempScale: cal.TempScale, HumiOffset: cal.HumiOffset, HumiScale: cal.HumiScale}});
+    ws.send(msg);
+    console.log("sent: ", msg);
+  });
   device.update = function(msg) {
     if (!device.touching) {
       drawThermoLines(device.thermoControl, msg.Thermostat.Settings.High, msg.Thermostat.Settings.Low, msg.Thermometer.Temp, thermStatus.committed);
@@ -238,14 +333,21 @@ function createThermostat(device) {
     var temp = msg.Thermometer.Temp;
     // var hum = msg.Thermometer.Humidity; // not used
     // var target = msg.Thermostat.Target;
+    var raw = msg.Thermometer.RawTemp;
     if (units == "F") {
       // target = convertToF(target);
       temp = convertToF(temp);
+      raw = convertToF(raw);
     }
     // Now update the values for current temp/hum and target.
     // thdiv.childNodes[2].childNodes[1].innerText = thdata.Humidity;
 
     devdom.childNodes[3].textContent = temp.toFixed(0) + "*";
+    devdom.querySelector(".sensor").textContent = "Raw sensor temp: " + raw.toFixed(1) + "*";
+    devdom.querySelector(".away").style.display = msg.Thermostat.Away ? "" : "none";
+    var faultEle = devdom.querySelector(".fault");
+    faultEle.textContent = thermoFaults[msg.Thermostat.Fault] || "";
+    faultEle.style.display = msg.Thermostat.Fault ? "" : "none";
 
     if (msg.Thermostat.State == 1) { // Cooling
       devdom.childNodes[1].setAttribute("fill", "#3399FF");
@@ -264,12 +366,26 @@ function createThermostat(device) {
   }
 }
 function createPortal(device) {
+  var lockEle = device.itemEle.querySelector("[name=lock]");
+  lockEle.addEventListener("click", function(e) {
+    if (editing) {
+      return;
+    }
+    e.stopPropagation(); // don't open/close the door when changing the lock.
+    var lock = 2; // Lock
+    if (device.msg.Portal.Lock == 2) {
+      lock = 1; // Unlock
+    }
+    var msg = JSON.stringify({ID: device.id, Lock: lock})
+    ws.send(msg);
+    console.log(msg);
+  });
   device.itemEle.addEventListener("click", function(){
     var state = 1;
     if (device.msg.Portal.State == 1) {
       state = 2;
     }
-    var msg = JSON.stringify({Name: device.name, Toggle: state})
+    var msg = JSON.stringify({ID: device.id, Toggle: state})
     ws.send(msg);
     console.log(msg);
   });
@@ -281,6 +397,23 @@ function createPortal(device) {
     device.itemEle.childNodes[4].style.display = "none";
     device.itemEle.childNodes[6].style.display = "none";
     device.itemEle.childNodes[8].style.display = "none";
+    if (msg.Portal.State >= 5) {
+      // Stopped or obstructed, highlight so someone checks on it.
+      device.itemEle.childNodes[1].setAttribute("fill", "#FF9999");
+    } else {
+      device.itemEle.childNodes[1].setAttribute("fill", "white");
+    }
+    if (msg.Portal.Lock == 0) {
+      lockEle.style.display = "none"; // No lock on this portal
+    } else {
+      lockEle.style.display = "block";
+      var color = "red"; // Unlocked
+      if (msg.Portal.Lock == 2) {
+        color = "green"; // Locked
+      }
+      lockEle.childNodes[0].setAttribute("fill", color);
+      lockEle.childNodes[1].setAttribute("stroke", color);
+    }
     if (msg.Portal.State != 1) {
       // Open state
       if (device.hovered) {
@@ -315,7 +448,7 @@ function createSwitch(device) {
     if (device.msg.Switch.On) {
       on = 2
     }
-    var msg = JSON.stringify({Name: device.name, Toggle: on})
+    var msg = JSON.stringify({ID: device.id, Toggle: on})
     ws.send(msg);
     console.log(msg);
   });
@@ -471,7 +604,7 @@ function thermoInteraction(device) {
     device.msg.Thermostat.Settings.Low =  m - spread/2;
     device.msg.Thermostat.Settings.High = m + spread/2;
     drawThermoLines(device.thermoControl, device.msg.Thermostat.Settings.High, device.msg.Thermostat.Settings.Low, device.msg.Thermometer.Temp, thermStatus.pushed);
-    var msg = JSON.stringify({Name: device.name, Climate: {High: m + spread/2, Low: m - spread/2}} );
+    var msg = JSON.stringify({ID: device.id, Climate: {High: m + spread/2, Low: m - spread/2}} );
     ws.send(msg);
     console.log("sent: ", msg);
   }
@@ -709,7 +842,7 @@ function addEditorControls(device) {
     var roomPos = getRoomPos(e.clientX, e.clientY);
     if (roomPos != null) {
       // TODO: re-attach to correct floor.
-      var msg = JSON.stringify({Name: device.name, Pos: {RoomID: roomPos.id, X: roomPos.x, Y: roomPos.y }});
+      var msg = JSON.stringify({ID: device.id, Pos: {RoomID: roomPos.id, X: roomPos.x, Y: roomPos.y }});
       ws.send(msg);
       console.log("sent: ", msg);
     }
@@ -750,7 +883,7 @@ function addEditorControls(device) {
     var roomPos = getRoomPos(e.changedTouches[0].clientX, e.changedTouches[0].clientY);
     if (roomPos != null) {
       // TODO: re-attach to correct floor.
-      var msg = JSON.stringify({Name: device.name, Pos: {RoomID: roomPos.id, X: roomPos.x, Y: roomPos.y }});
+      var msg = JSON.stringify({ID: device.id, Pos: {RoomID: roomPos.id, X: roomPos.x, Y: roomPos.y }});
       ws.send(msg);
       console.log("sent: ", msg);
     }
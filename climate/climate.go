@@ -1,10 +1,8 @@
 package climate
 
 import (
-	"fmt"
 	"time"
 
-	rpio "github.com/stianeikeland/go-rpio"
 	"gitlab.com/lologarithm/refuge/refuge"
 	"gitlab.com/lologarithm/refuge/sensor"
 )
@@ -17,99 +15,50 @@ type Controller interface {
 	State() refuge.ControlState
 }
 
-type RealController struct {
-	FanP  rpio.Pin
-	CoolP rpio.Pin
-	HeatP rpio.Pin
-
-	state refuge.ControlState
-}
-
-func NewController(h, c, f int) *RealController {
-	fan := rpio.Pin(f)
-	fan.Mode(rpio.Output)
-	fan.High()
-	cool := rpio.Pin(c)
-	cool.Mode(rpio.Output)
-	cool.High()
-	heat := rpio.Pin(h)
-	heat.Mode(rpio.Output)
-	heat.High()
-
-	return &RealController{
-		FanP:  fan,
-		CoolP: cool,
-		HeatP: heat,
-	}
-}
-
-func (rc *RealController) Heat() {
-	rc.CoolP.High()
-
-	rc.FanP.Low()
-	rc.HeatP.Low()
-
-	rc.state = refuge.StateHeating
-}
-
-func (rc *RealController) Cool() {
-	rc.HeatP.High()
-
-	rc.FanP.Low()
-	rc.CoolP.Low()
-
-	rc.state = refuge.StateCooling
-}
-
-func (rc *RealController) Fan() {
-	rc.FanP.Low()
-
-	rc.CoolP.High()
-	rc.HeatP.High()
-
-	rc.state = refuge.StateFanning
+// Stager is a Controller with more than one stage of heating or cooling.
+// Heat and Cool start at the first stage.
+type Stager interface {
+	Controller
+	// Stages returns how many stages there are for heating or cooling, including aux heat.
+	Stages(state refuge.ControlState) int
+	// SetStage runs the current heating/cooling with stages 1 to stage on.
+	SetStage(stage int)
+	// Stage returns the current stage and whether aux heat is on.
+	Stage() (int, bool)
+	// EmergencyHeat heats with only the aux heat.
+	EmergencyHeat()
 }
 
-func (rc *RealController) Off() {
-	rc.FanP.High()
-	rc.CoolP.High()
-	rc.HeatP.High()
-
-	rc.state = refuge.StateIdle
-}
-
-func (rc RealController) State() refuge.ControlState {
-	return rc.state
-}
-
-// Does nothing. used for running without actually doing anything
+// Does nothing but remember what it was told. used for running without actually doing anything
 type FakeController struct {
+	state refuge.ControlState
 }
 
-func (fc FakeController) Heat()                      {}
-func (fc FakeController) Cool()                      {}
-func (fc FakeController) Fan()                       {}
-func (fc FakeController) Off()                       {}
-func (fc FakeController) State() refuge.ControlState { return 0 }
+func (fc *FakeController) Heat()                      { fc.state = refuge.StateHeating }
+func (fc *FakeController) Cool()                      { fc.state = refuge.StateCooling }
+func (fc *FakeController) Fan()                       { fc.state = refuge.StateFanning }
+func (fc *FakeController) Off()                       { fc.state = refuge.StateIdle }
+func (fc *FakeController) State() refuge.ControlState { return fc.state }
 
 // ControlLoop accepts a stream of input to control heating/cooling
-func ControlLoop(controller Controller, setStream chan refuge.Settings, thermStream chan sensor.ThermalReading, motionStream chan int64) {
+func ControlLoop(controller Controller, opts Options, setStream chan refuge.Settings, thermStream chan sensor.ThermalReading, motionStream chan int64) {
+	g := NewGuard(controller, opts)
 	s := refuge.Settings{}
 	// Run the climate control system here.
 	lastTherm := <-thermStream
 	lastMotion := time.Now()
-	fmt.Printf("Starting control loop now...\n")
+	g.printf("Starting control loop now...\n")
 
 	for {
 		select {
 		case v := <-thermStream:
 			lastTherm = v
-			Control(controller, s, lastMotion, lastTherm)
+			Control(g, s, DefaultSetback, lastMotion, lastTherm)
 		case t := <-motionStream:
 			lastMotion = time.Unix(t, 0)
-			Control(controller, s, lastMotion, lastTherm)
+			Control(g, s, DefaultSetback, lastMotion, lastTherm)
 		case set := <-setStream:
-			fmt.Printf("Climate Loop: changing settings: %#v\n", set)
+			g.printf("Climate Loop: changing settings: %#v\n", set)
 			s.High = set.High
 			s.Low = set.Low
 			if set.Mode != refuge.ModeUnset {
@@ -118,59 +67,143 @@ func ControlLoop(controller Controller, setStream chan refuge.Settings, thermStr
 		}
 		if s.High == 0 || s.Low == 0 || s.Mode == refuge.ModeUnset {
 			// Exit!
-			fmt.Printf("No valid high/low temp specified. Control loop exiting.\n")
+			g.printf("No valid high/low temp specified. Control loop exiting.\n")
 			return
 		}
 	}
 }
 
-// Control accepts current state and decides what to change
-func Control(controller Controller, s refuge.Settings, lastMotion time.Time, tr sensor.ThermalReading) float32 {
-	fmt.Printf(" Climate Loop: Temp: %.1f, Hum: %.1f State: %v\n", tr.Temp, tr.Humi, s)
-	state := controller.State()
+// Control accepts current state and decides what to change.
+// Returns the temp it is heating/cooling towards, 0 if idle and -1 if turned off.
+// The range is widened by the setback once no motion has been seen for its away delay.
+// The time of the reading is used as the current time (now if unset) so a sequence of readings can be replayed.
+func Control(g *Guard, s refuge.Settings, sb refuge.Setback, lastMotion time.Time, tr sensor.ThermalReading) float32 {
+	g.printf(" Climate Loop: Temp: %.1f, Hum: %.1f State: %v\n", tr.Temp, tr.Humi, s)
+	now := tr.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if g.stopped.IsZero() {
+		// Off since it was started as far as we know, so a restart can't short cycle the compressor.
+		g.stopped = now
+	}
+	state := g.State()
+	freezing := g.fault == refuge.FaultFreeze && state == refuge.StateHeating
+	g.fault = refuge.FaultNone
+
+	// Once started, freeze protection keeps heating until past the limit by the overshoot.
+	if tr.Temp < g.Freeze || (freezing && tr.Temp < g.Freeze+g.Overshoot) {
+		return freezeProtect(g, s, tr, now)
+	}
+	overTemp := tr.Temp > g.OverTemp
+	if overTemp {
+		g.fault = refuge.FaultOverTemp
+		if state == refuge.StateHeating {
+			g.printf("Climate Loop: Temp is over %.1fC, disabling heating now...\n", g.OverTemp)
+			g.shutdown(now)
+			state = g.State()
+		}
+	}
 
 	if s.Mode == refuge.ModeOff {
 		if state != refuge.StateIdle {
-			fmt.Println("Thermostat was manually disabled.")
-			controller.Off()
+			g.printf("Thermostat was manually disabled.\n")
+			g.shutdown(now)
 		}
 		return -1
 	}
 
-	tempOffset := float32(0)
-	if time.Now().Sub(lastMotion) > time.Minute*30 {
-		fmt.Printf("Climate Loop: Its been over 30 min since motion was seen, increasing temp range by 2C\n")
-		tempOffset = 2
+	high, low := s.High, s.Low
+	if Away(sb, lastMotion, now) {
+		g.printf("Climate Loop: Its been over %d min since motion was seen, setting back temp range by %.1fC/%.1fC\n", sb.AwayMinutes, sb.Heat, sb.Cool)
+		high += sb.Cool
+		low -= sb.Heat
 	}
-	if state == refuge.StateHeating || state == refuge.StateCooling {
-		tempOffset -= 1.5 // We want to go a little over the temp we are targetting.
-	}
-
-	if tr.Temp > s.High+tempOffset {
-		if state != refuge.StateCooling {
-			fmt.Printf("Climate Loop: Activating cooling...\n")
-			controller.Cool()
-		} else {
-			fmt.Printf("Climate Loop: Still cooling...\n")
+	// Start past the setting by the hysteresis and keep going until past it by the overshoot.
+	coolOn, coolOff := high+g.Hysteresis, high-g.Overshoot
+	heatOn, heatOff := low-g.Hysteresis, low+g.Overshoot
+
+	switch state {
+	case refuge.StateCooling:
+		if tr.Temp > coolOff && s.Mode != refuge.ModeEmergencyHeat {
+			g.printf("Climate Loop: Still cooling...\n")
+			g.stage(tr.Temp-high, now)
+			return coolOff
+		}
+		g.printf("Climate Loop: Disabling cooling...\n")
+		if !g.stop(now, s.Mode == refuge.ModeFan) {
+			return coolOff
+		}
+	case refuge.StateHeating:
+		if tr.Temp < heatOff {
+			g.printf("Climate Loop: still heating...\n")
+			if s.Mode != refuge.ModeEmergencyHeat {
+				g.stage(low-tr.Temp, now)
+			}
+			return heatOff
+		}
+		g.printf("Climate Loop: Disabling heating...\n")
+		if !g.stop(now, s.Mode == refuge.ModeFan) {
+			return heatOff
 		}
-		return s.High + tempOffset
-	} else if tr.Temp < s.Low-tempOffset {
-		if state != refuge.StateHeating {
-			fmt.Printf("Climate Loop: Activating heating...\n")
-			controller.Heat()
-		} else {
-			fmt.Printf("Climate Loop: still heating...\n")
+	default:
+		emergency := s.Mode == refuge.ModeEmergencyHeat
+		if tr.Temp > coolOn && !emergency {
+			g.printf("Climate Loop: Activating cooling...\n")
+			if g.start(refuge.StateCooling, false, now) {
+				g.stage(tr.Temp-high, now)
+				return coolOff
+			}
+		} else if tr.Temp < heatOn && !overTemp {
+			g.printf("Climate Loop: Activating heating...\n")
+			if g.start(refuge.StateHeating, emergency, now) {
+				if !emergency {
+					g.stage(low-tr.Temp, now)
+				}
+				return heatOff
+			}
 		}
-		return s.Low - tempOffset
-	} else if state != refuge.StateIdle {
-		if s.Mode == refuge.ModeAuto {
-			// First time after reaching goal temp, disable climate control
-			fmt.Printf("Climate Loop: Disabling all climate controls...\n")
-			controller.Off()
+		if s.Mode == refuge.ModeFan && state == refuge.StateIdle {
+			g.Fan()
+		} else if s.Mode != refuge.ModeFan && state == refuge.StateFanning {
+			g.printf("Climate Loop: Disabling all climate controls...\n")
+			g.Off()
 		}
-	} else if s.Mode == refuge.ModeFan && state == refuge.StateIdle {
-		controller.Fan()
 	}
-
 	return 0
 }
+
+// Failsafe turns everything off if the latest good reading, taken at readAt, is older than the SensorTimeout option.
+// Returns true if it did, Control should then not be called until there is a fresh reading.
+func Failsafe(g *Guard, readAt, now time.Time) bool {
+	if g.SensorTimeout <= 0 || now.Sub(readAt) <= g.SensorTimeout {
+		return false
+	}
+	if g.fault != refuge.FaultStale {
+		g.printf("Climate Loop: No good temp reading since %s, turning everything off.\n", readAt.Format("15:04:05 MST"))
+	}
+	g.fault = refuge.FaultStale
+	g.shutdown(now)
+	return true
+}
+
+// freezeProtect heats the house back above the freeze limit no matter the settings.
+func freezeProtect(g *Guard, s refuge.Settings, tr sensor.ThermalReading, now time.Time) float32 {
+	g.fault = refuge.FaultFreeze
+	target := g.Freeze + g.Overshoot
+	emergency := s.Mode == refuge.ModeEmergencyHeat
+	switch g.State() {
+	case refuge.StateHeating:
+		if !emergency {
+			g.stage(target-tr.Temp, now)
+		}
+		return target
+	case refuge.StateCooling:
+		g.shutdown(now)
+	}
+	g.printf("Climate Loop: Temp is under %.1fC, heating to protect from freezing...\n", g.Freeze)
+	if g.start(refuge.StateHeating, emergency, now) && !emergency {
+		g.stage(target-tr.Temp, now)
+	}
+	return target
+}
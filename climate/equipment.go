@@ -0,0 +1,199 @@
+package climate
+
+import (
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// Equipment is the profile of the heating/cooling system wired to the relays.
+// A pin of 0 means it isn't connected.
+type Equipment struct {
+	ActiveHigh bool  // Relays turn on when their pin is driven high. By default they are active low.
+	Fan        int   // Fan relay (G).
+	Heat       []int // Heat stage relays (W1, W2...). Not used by heat pumps, they heat with the Cool stages.
+	Cool       []int // Compressor stage relays (Y1, Y2...).
+	Aux        int   // Aux heat relay. Used as the last heat stage and for emergency heat.
+
+	HeatPump    bool // Heat by running the compressor with the reversing valve switched to heat.
+	Valve       int  // Reversing valve relay (O/B), heat pumps only.
+	ValveOnHeat bool // Valve is energized to heat (B). By default it is energized to cool (O).
+}
+
+// SingleStage is the equipment profile of a plain furnace and air conditioner with active low relays.
+func SingleStage(heat, cool, fan int) Equipment {
+	return Equipment{Fan: fan, Heat: []int{heat}, Cool: []int{cool}}
+}
+
+type RealController struct {
+	eq    Equipment
+	fan   gpio.Pin
+	heat  []gpio.Pin
+	cool  []gpio.Pin
+	aux   gpio.Pin
+	valve gpio.Pin
+
+	state     refuge.ControlState
+	stage     int
+	emergency bool
+	valveOn   bool // Valve stays in position while idle so it doesn't flip on every stop.
+}
+
+// NewController creates a single stage controller driving the heat, cool and fan relays on the given pins of the board.
+// The relays are active low and start off.
+func NewController(b gpio.Board, h, c, f int) *RealController {
+	return NewEquipmentController(b, SingleStage(h, c, f))
+}
+
+// NewEquipmentController creates a controller for the equipment wired to the board. All relays start off.
+func NewEquipmentController(b gpio.Board, eq Equipment) *RealController {
+	rc := &RealController{
+		eq:    eq,
+		fan:   gpio.Optional(b, eq.Fan),
+		aux:   gpio.Optional(b, eq.Aux),
+		valve: gpio.Optional(b, eq.Valve),
+	}
+	if !eq.HeatPump {
+		for _, p := range eq.Heat {
+			rc.heat = append(rc.heat, b.Pin(p))
+		}
+	}
+	for _, p := range eq.Cool {
+		rc.cool = append(rc.cool, b.Pin(p))
+	}
+	for _, p := range rc.pins() {
+		p.Output()
+		rc.set(p, false)
+	}
+	return rc
+}
+
+func (rc *RealController) Heat() {
+	rc.apply(refuge.StateHeating, 1, false)
+}
+
+func (rc *RealController) Cool() {
+	rc.apply(refuge.StateCooling, 1, false)
+}
+
+func (rc *RealController) Fan() {
+	rc.apply(refuge.StateFanning, 0, false)
+}
+
+func (rc *RealController) Off() {
+	rc.apply(refuge.StateIdle, 0, false)
+}
+
+func (rc RealController) State() refuge.ControlState {
+	return rc.state
+}
+
+// Stages implements Stager.
+func (rc *RealController) Stages(state refuge.ControlState) int {
+	switch state {
+	case refuge.StateHeating:
+		n := len(rc.heatStages())
+		if rc.aux != nil {
+			n++
+		}
+		return n
+	case refuge.StateCooling:
+		return len(rc.cool)
+	}
+	return 0
+}
+
+// SetStage implements Stager.
+func (rc *RealController) SetStage(stage int) {
+	if rc.state != refuge.StateHeating && rc.state != refuge.StateCooling {
+		return
+	}
+	rc.apply(rc.state, stage, rc.emergency)
+}
+
+// Stage implements Stager.
+func (rc *RealController) Stage() (int, bool) {
+	return rc.stage, rc.state == refuge.StateHeating && rc.aux != nil && (rc.emergency || rc.stage > len(rc.heatStages()))
+}
+
+// EmergencyHeat implements Stager. Falls back to normal heat if there is no aux heat.
+func (rc *RealController) EmergencyHeat() {
+	if rc.aux == nil {
+		rc.Heat()
+		return
+	}
+	rc.apply(refuge.StateHeating, 1, true)
+}
+
+// heatStages returns the relays used to heat, the compressor for heat pumps.
+func (rc *RealController) heatStages() []gpio.Pin {
+	if rc.eq.HeatPump {
+		return rc.cool
+	}
+	return rc.heat
+}
+
+// apply switches the relays for the state, with the first "stage" stages on.
+// Relays are turned off before any are turned on so heating and cooling never overlap.
+func (rc *RealController) apply(state refuge.ControlState, stage int, emergency bool) {
+	on := map[gpio.Pin]bool{}
+	if state != refuge.StateIdle {
+		on[rc.fan] = true
+	}
+	stages := []gpio.Pin{}
+	switch state {
+	case refuge.StateHeating:
+		if !emergency {
+			stages = rc.heatStages()
+		}
+		if rc.aux != nil && (emergency || stage > len(stages)) {
+			on[rc.aux] = true
+		}
+	case refuge.StateCooling:
+		stages = rc.cool
+	}
+	for i := 0; i < stage && i < len(stages); i++ {
+		on[stages[i]] = true
+	}
+	if rc.valve != nil && rc.eq.HeatPump {
+		switch state {
+		case refuge.StateHeating:
+			rc.valveOn = rc.eq.ValveOnHeat
+		case refuge.StateCooling:
+			rc.valveOn = !rc.eq.ValveOnHeat
+		}
+		on[rc.valve] = rc.valveOn
+	}
+
+	for _, p := range rc.pins() {
+		if !on[p] {
+			rc.set(p, false)
+		}
+	}
+	for _, p := range rc.pins() {
+		if on[p] {
+			rc.set(p, true)
+		}
+	}
+	rc.state, rc.stage, rc.emergency = state, stage, emergency
+}
+
+// pins returns every connected relay, valve first so it is in position before the compressor starts.
+func (rc *RealController) pins() []gpio.Pin {
+	all := []gpio.Pin{}
+	for _, p := range []gpio.Pin{rc.valve, rc.fan, rc.aux} {
+		if p != nil {
+			all = append(all, p)
+		}
+	}
+	all = append(all, rc.heat...)
+	return append(all, rc.cool...)
+}
+
+// set turns the relay on the pin on or off.
+func (rc *RealController) set(p gpio.Pin, on bool) {
+	if on == rc.eq.ActiveHigh {
+		p.High()
+	} else {
+		p.Low()
+	}
+}
@@ -0,0 +1,183 @@
+package climate
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// Relay pins of the test equipment.
+const (
+	pinFan   = 1
+	pinW1    = 2
+	pinW2    = 3
+	pinY1    = 4
+	pinY2    = 5
+	pinAux   = 6
+	pinValve = 7
+)
+
+var allPins = []int{pinFan, pinW1, pinW2, pinY1, pinY2, pinAux, pinValve}
+
+// relaysOn returns the pins of the board whose relays are on.
+func relaysOn(b *gpio.Fake, activeHigh bool) []int {
+	on := []int{}
+	for _, n := range allPins {
+		p := b.FakePin(n)
+		if p.IsOutput() && p.Level() == activeHigh {
+			on = append(on, n)
+		}
+	}
+	return on
+}
+
+func TestEquipmentRelays(t *testing.T) {
+	twoStage := Equipment{Fan: pinFan, Heat: []int{pinW1, pinW2}, Cool: []int{pinY1, pinY2}, Aux: pinAux}
+	heatPumpO := Equipment{Fan: pinFan, Cool: []int{pinY1, pinY2}, Aux: pinAux, HeatPump: true, Valve: pinValve}
+	heatPumpB := heatPumpO
+	heatPumpB.ValveOnHeat = true
+	activeHigh := SingleStage(pinW1, pinY1, pinFan)
+	activeHigh.ActiveHigh = true
+
+	tests := []struct {
+		name  string
+		eq    Equipment
+		run   func(rc *RealController)
+		on    []int
+		stage int
+		aux   bool
+	}{
+		{"single stage off", SingleStage(pinW1, pinY1, pinFan), func(rc *RealController) {}, []int{}, 0, false},
+		{"single stage heat", SingleStage(pinW1, pinY1, pinFan), (*RealController).Heat, []int{pinFan, pinW1}, 1, false},
+		{"single stage cool", SingleStage(pinW1, pinY1, pinFan), (*RealController).Cool, []int{pinFan, pinY1}, 1, false},
+		{"single stage fan", SingleStage(pinW1, pinY1, pinFan), (*RealController).Fan, []int{pinFan}, 0, false},
+		{"single stage heat then off", SingleStage(pinW1, pinY1, pinFan), func(rc *RealController) {
+			rc.Heat()
+			rc.Off()
+		}, []int{}, 0, false},
+		{"single stage emergency without aux", SingleStage(pinW1, pinY1, pinFan), (*RealController).EmergencyHeat, []int{pinFan, pinW1}, 1, false},
+		{"single stage stage 2", SingleStage(pinW1, pinY1, pinFan), func(rc *RealController) {
+			rc.Cool()
+			rc.SetStage(2)
+		}, []int{pinFan, pinY1}, 2, false},
+
+		{"active high off", activeHigh, func(rc *RealController) {}, []int{}, 0, false},
+		{"active high heat", activeHigh, (*RealController).Heat, []int{pinFan, pinW1}, 1, false},
+		{"active high cool", activeHigh, (*RealController).Cool, []int{pinFan, pinY1}, 1, false},
+
+		{"heat stage 1", twoStage, (*RealController).Heat, []int{pinFan, pinW1}, 1, false},
+		{"heat stage 2", twoStage, func(rc *RealController) {
+			rc.Heat()
+			rc.SetStage(2)
+		}, []int{pinFan, pinW1, pinW2}, 2, false},
+		{"heat stage 3 is aux", twoStage, func(rc *RealController) {
+			rc.Heat()
+			rc.SetStage(3)
+		}, []int{pinFan, pinW1, pinW2, pinAux}, 3, true},
+		{"back down from aux", twoStage, func(rc *RealController) {
+			rc.Heat()
+			rc.SetStage(3)
+			rc.SetStage(1)
+		}, []int{pinFan, pinW1}, 1, false},
+		{"cool stage 2", twoStage, func(rc *RealController) {
+			rc.Cool()
+			rc.SetStage(2)
+		}, []int{pinFan, pinY1, pinY2}, 2, false},
+		{"emergency heat is only aux", twoStage, (*RealController).EmergencyHeat, []int{pinFan, pinAux}, 1, true},
+		{"emergency heat ignores stages", twoStage, func(rc *RealController) {
+			rc.EmergencyHeat()
+			rc.SetStage(2)
+		}, []int{pinFan, pinAux}, 2, true},
+		{"staging ignored while idle", twoStage, func(rc *RealController) {
+			rc.SetStage(2)
+		}, []int{}, 0, false},
+
+		{"heat pump O heat", heatPumpO, (*RealController).Heat, []int{pinFan, pinY1}, 1, false},
+		{"heat pump O cool", heatPumpO, (*RealController).Cool, []int{pinFan, pinY1, pinValve}, 1, false},
+		{"heat pump O cool then off", heatPumpO, func(rc *RealController) {
+			rc.Cool()
+			rc.Off()
+		}, []int{pinValve}, 0, false},
+		{"heat pump O cool then heat", heatPumpO, func(rc *RealController) {
+			rc.Cool()
+			rc.Heat()
+		}, []int{pinFan, pinY1}, 1, false},
+		{"heat pump O aux", heatPumpO, func(rc *RealController) {
+			rc.Heat()
+			rc.SetStage(3)
+		}, []int{pinFan, pinY1, pinY2, pinAux}, 3, true},
+		{"heat pump B heat", heatPumpB, (*RealController).Heat, []int{pinFan, pinY1, pinValve}, 1, false},
+		{"heat pump B cool", heatPumpB, (*RealController).Cool, []int{pinFan, pinY1}, 1, false},
+		{"heat pump B heat then fan", heatPumpB, func(rc *RealController) {
+			rc.Heat()
+			rc.Fan()
+		}, []int{pinFan, pinValve}, 0, false},
+		{"heat pump B emergency", heatPumpB, (*RealController).EmergencyHeat, []int{pinFan, pinAux, pinValve}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := gpio.NewFake()
+			rc := NewEquipmentController(b, tt.eq)
+			tt.run(rc)
+			if got := relaysOn(b, tt.eq.ActiveHigh); !reflect.DeepEqual(got, tt.on) {
+				t.Errorf("relays on %v, want %v", got, tt.on)
+			}
+			if stage, aux := rc.Stage(); stage != tt.stage || aux != tt.aux {
+				t.Errorf("stage %d aux %v, want %d aux %v", stage, aux, tt.stage, tt.aux)
+			}
+		})
+	}
+}
+
+func TestEquipmentStart(t *testing.T) {
+	for _, activeHigh := range []bool{false, true} {
+		b := gpio.NewFake()
+		// Connected pins start as outputs with their relays off, unconnected ones aren't touched.
+		NewEquipmentController(b, Equipment{ActiveHigh: activeHigh, Fan: pinFan, Cool: []int{pinY1}})
+		for _, n := range []int{pinFan, pinY1} {
+			if p := b.FakePin(n); !p.IsOutput() || p.Level() != !activeHigh {
+				t.Errorf("active high %v: pin %d output %v level %v", activeHigh, n, p.IsOutput(), p.Level())
+			}
+		}
+		if b.FakePin(pinW1).IsOutput() {
+			t.Errorf("active high %v: unconnected heat pin set to output", activeHigh)
+		}
+	}
+}
+
+func TestEquipmentOffFirst(t *testing.T) {
+	b := gpio.NewFake()
+	rc := NewEquipmentController(b, SingleStage(pinW1, pinY1, pinFan))
+	rc.Heat()
+
+	// Heat turns off before cool turns on.
+	writes := []string{}
+	for _, n := range []int{pinW1, pinY1} {
+		name := map[int]string{pinW1: "heat", pinY1: "cool"}[n]
+		b.FakePin(n).OnWrite = func(high bool) {
+			state := " on"
+			if high {
+				state = " off"
+			}
+			writes = append(writes, name+state)
+		}
+	}
+	rc.Cool()
+	heatOff, coolOn := -1, -1
+	for i, w := range writes {
+		switch {
+		case w == "heat off" && heatOff < 0:
+			heatOff = i
+		case w == "cool on" && coolOn < 0:
+			coolOn = i
+		}
+	}
+	if heatOff < 0 || coolOn < heatOff {
+		t.Errorf("relay writes %v, want heat off before cool on", writes)
+	}
+	if rc.State() != refuge.StateCooling {
+		t.Errorf("state %v, want cooling", rc.State())
+	}
+}
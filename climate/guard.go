@@ -0,0 +1,162 @@
+package climate
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// Options tune when Control turns the heating/cooling on and off.
+type Options struct {
+	Hysteresis float32       // How far (C) past the low/high setting the temp has to get before heating/cooling starts.
+	Overshoot  float32       // How far (C) past the low/high setting to keep heating/cooling before stopping.
+	MinRun     time.Duration // Heating/cooling runs at least this long once started.
+	MinOff     time.Duration // Heating/cooling stays off at least this long once stopped.
+
+	// Multi-stage equipment adds a stage for every StageDelta (C) the temp is from the setting,
+	// and whenever the current stage has run StageTime without reaching it. 0 disables either.
+	StageDelta float32
+	StageTime  time.Duration
+
+	// Hard limits that override the settings. Heating is forced on below Freeze and off above OverTemp,
+	// and everything is turned off once the latest good reading is older than SensorTimeout (0 disables it).
+	Freeze        float32
+	OverTemp      float32
+	SensorTimeout time.Duration
+}
+
+// DefaultOptions protect a typical compressor from short cycling and the house from freezing or overheating.
+var DefaultOptions = Options{
+	Hysteresis:    0,
+	Overshoot:     1.5,
+	MinRun:        time.Minute * 5,
+	MinOff:        time.Minute * 5,
+	StageDelta:    2,
+	StageTime:     time.Minute * 10,
+	Freeze:        5,
+	OverTemp:      35,
+	SensorTimeout: time.Minute * 15,
+}
+
+// Guard wraps a Controller and tracks when heating/cooling last started and stopped
+// so Control can enforce the minimum run and off times.
+type Guard struct {
+	Controller
+	Options
+	Quiet bool // Don't log every decision of Control, like when simulating days of readings.
+
+	started time.Time // when heating/cooling last started
+	stopped time.Time // when heating/cooling last stopped, or the first reading if it hasn't run yet
+	staged  time.Time // when the current stage started
+	fault   refuge.Fault
+}
+
+// NewGuard protects the controller with the given options.
+func NewGuard(cl Controller, opts Options) *Guard {
+	return &Guard{Controller: cl, Options: opts}
+}
+
+func (g *Guard) printf(format string, args ...interface{}) {
+	if !g.Quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+func (g *Guard) running() bool {
+	state := g.State()
+	return state == refuge.StateHeating || state == refuge.StateCooling
+}
+
+// start turns on heating or cooling unless it hasn't been off for MinOff yet.
+// Emergency heat only uses the aux heat of a Stager.
+// Returns true if it was started.
+func (g *Guard) start(state refuge.ControlState, emergency bool, now time.Time) bool {
+	if now.Sub(g.stopped) < g.MinOff {
+		g.printf("Climate Loop: Waiting %s before starting again...\n", g.MinOff-now.Sub(g.stopped))
+		return false
+	}
+	st, staged := g.Controller.(Stager)
+	switch {
+	case state == refuge.StateHeating && emergency && staged:
+		st.EmergencyHeat()
+	case state == refuge.StateHeating:
+		g.Heat()
+	default:
+		g.Cool()
+	}
+	g.started = now
+	g.staged = now
+	return true
+}
+
+// stage adds stages to multi-stage equipment based on how far (C) the temp is from the setting
+// and how long the current stage has run. Stages are only dropped when heating/cooling stops.
+func (g *Guard) stage(distance float32, now time.Time) {
+	st, ok := g.Controller.(Stager)
+	if !ok {
+		return
+	}
+	cur, _ := st.Stage()
+	want := cur
+	if g.StageDelta > 0 && distance > 0 {
+		if byDistance := 1 + int(distance/g.StageDelta); byDistance > want {
+			want = byDistance
+		}
+	}
+	if g.StageTime > 0 && now.Sub(g.staged) >= g.StageTime && want == cur {
+		want = cur + 1
+	}
+	if max := st.Stages(g.State()); want > max {
+		want = max
+	}
+	if want > cur {
+		g.printf("Climate Loop: Moving up to stage %d...\n", want)
+		st.SetStage(want)
+		g.staged = now
+	}
+}
+
+// Fault returns why the last Control or Failsafe call put the system in its failsafe, if it did.
+func (g *Guard) Fault() refuge.Fault {
+	return g.fault
+}
+
+// Staging returns the current stage and whether aux heat is on.
+// Single stage controllers are at stage 1 while heating/cooling.
+func (g *Guard) Staging() (int, bool) {
+	if st, ok := g.Controller.(Stager); ok {
+		return st.Stage()
+	}
+	if g.running() {
+		return 1, false
+	}
+	return 0, false
+}
+
+// stop turns off heating/cooling, leaving the fan running if fan is set,
+// unless heating/cooling hasn't run for MinRun yet. Returns true if it was stopped.
+func (g *Guard) stop(now time.Time, fan bool) bool {
+	running := g.running()
+	if running && now.Sub(g.started) < g.MinRun {
+		g.printf("Climate Loop: Running %s longer before stopping...\n", g.MinRun-now.Sub(g.started))
+		return false
+	}
+	if fan {
+		g.Fan()
+	} else {
+		g.Off()
+	}
+	if running {
+		g.stopped = now
+	}
+	return true
+}
+
+// shutdown turns everything off right away, ignoring MinRun.
+func (g *Guard) shutdown(now time.Time) {
+	if g.running() {
+		g.stopped = now
+	}
+	g.Off()
+}
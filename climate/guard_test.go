@@ -0,0 +1,166 @@
+package climate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// relay is a change of the heating/cooling at a time into the test.
+type relay struct {
+	At    time.Duration
+	State refuge.ControlState
+	Stage int
+}
+
+// timeline runs Control on a reading of each temp, one a minute, and returns every change of the relays.
+func timeline(g *Guard, s refuge.Settings, temps []float32) []relay {
+	g.Quiet = true
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	changes := []relay{}
+	last := relay{}
+	for i, temp := range temps {
+		at := time.Duration(i) * time.Minute
+		Control(g, s, refuge.Setback{}, start, sensor.ThermalReading{Temp: temp, Time: start.Add(at)})
+		stage, _ := g.Staging()
+		if now := (relay{At: at, State: g.State(), Stage: stage}); now.State != last.State || now.Stage != last.Stage {
+			changes = append(changes, now)
+			last = now
+		}
+	}
+	return changes
+}
+
+// repeat returns the temp n times.
+func repeat(temp float32, n int) []float32 {
+	temps := make([]float32, n)
+	for i := range temps {
+		temps[i] = temp
+	}
+	return temps
+}
+
+func join(temps ...[]float32) []float32 {
+	all := []float32{}
+	for _, t := range temps {
+		all = append(all, t...)
+	}
+	return all
+}
+
+var testSettings = refuge.Settings{Low: 20, High: 25, Mode: refuge.ModeAuto}
+
+func TestGuardTimeline(t *testing.T) {
+	heat := func(at time.Duration) relay { return relay{At: at, State: refuge.StateHeating, Stage: 1} }
+	cool := func(at time.Duration) relay { return relay{At: at, State: refuge.StateCooling, Stage: 1} }
+	idle := func(at time.Duration) relay { return relay{At: at, State: refuge.StateIdle} }
+	min := time.Minute
+
+	tests := []struct {
+		name  string
+		opts  func(*Options)
+		temps []float32
+		want  []relay
+	}{
+		{
+			name:  "min off at startup",
+			temps: repeat(18, 8),
+			want:  []relay{heat(5 * min)},
+		},
+		{
+			name:  "in range",
+			temps: repeat(22, 10),
+			want:  []relay{},
+		},
+		{
+			// Warm enough right after starting, but keeps heating for the min run.
+			name:  "min run",
+			temps: join(repeat(18, 6), repeat(22, 6)),
+			want:  []relay{heat(5 * min), idle(10 * min)},
+		},
+		{
+			// Cold again right after stopping, but stays off for the min off.
+			name:  "min off",
+			temps: join(repeat(18, 6), repeat(22, 5), repeat(18, 6)),
+			want:  []relay{heat(5 * min), idle(10 * min), heat(15 * min)},
+		},
+		{
+			// Keeps heating until past the low setting by the overshoot.
+			name:  "overshoot",
+			temps: join(repeat(18, 6), []float32{20.5, 21, 21.4, 21.4, 21.4, 21.6}),
+			want:  []relay{heat(5 * min), idle(11 * min)},
+		},
+		{
+			name:  "cooling",
+			temps: join(repeat(22, 5), repeat(26, 6), repeat(23, 6)),
+			want:  []relay{cool(5 * min), idle(11 * min)},
+		},
+		{
+			name:  "hysteresis",
+			opts:  func(o *Options) { o.Hysteresis = 1 },
+			temps: join(repeat(22, 5), repeat(19.5, 3), repeat(18.9, 2)),
+			want:  []relay{heat(8 * min)},
+		},
+		{
+			name:  "no min times",
+			opts:  func(o *Options) { o.MinRun, o.MinOff = 0, 0 },
+			temps: []float32{18, 22, 18},
+			want:  []relay{heat(0), idle(1 * min), heat(2 * min)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			got := timeline(NewGuard(&FakeController{}, opts), testSettings, tt.temps)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardStaging(t *testing.T) {
+	stage := func(at time.Duration, n int) relay { return relay{At: at, State: refuge.StateHeating, Stage: n} }
+	min := time.Minute
+
+	tests := []struct {
+		name  string
+		temps []float32
+		want  []relay
+	}{
+		{
+			// 3C under the setting is past the first stage delta, both stages start together.
+			name:  "by distance",
+			temps: repeat(17, 7),
+			want:  []relay{stage(5*min, 2)},
+		},
+		{
+			// The first stage isn't catching up, the second is added after the stage time.
+			name:  "by time",
+			temps: repeat(19, 17),
+			want:  []relay{stage(5*min, 1), stage(15*min, 2)},
+		},
+		{
+			// Stages aren't dropped as the temp comes up, only when heating stops.
+			name:  "kept until stopped",
+			temps: join(repeat(17, 6), repeat(20.5, 3), repeat(21.6, 2)),
+			want:  []relay{stage(5*min, 2), {At: 10 * min, State: refuge.StateIdle}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			house := NewHouse(20, DailyOutdoor(0, 0), time.Time{})
+			house.NumStages = 2
+			got := timeline(NewGuard(house, DefaultOptions), testSettings, tt.temps)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
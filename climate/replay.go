@@ -0,0 +1,64 @@
+package climate
+
+import (
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// Replay runs Control on every reading of a sensor recording, at the time it was recorded, to see what it
+// would have done. Motion in the recording moves the last motion like a motion sensor would.
+// Speed scales the wait between records: 1 replays in real time, 0 replays as fast as possible.
+// Samples have no outdoor temp, comfort violations are counted like Simulate.
+func Replay(g *Guard, records []sensor.Record, s refuge.Settings, sb refuge.Setback, speed float64, tolerance float32) SimResult {
+	res := SimResult{}
+	if len(records) == 0 {
+		return res
+	}
+	lastMotion := records[0].Time
+	moving := false
+	prev := records[0].Time
+	for _, rec := range records {
+		gap := rec.Time.Sub(prev)
+		prev = rec.Time
+		if speed > 0 && gap > 0 {
+			time.Sleep(time.Duration(float64(gap) / speed))
+		}
+		// The state and temp of the last reading held until this record.
+		if n := len(res.Samples); n > 0 {
+			last := res.Samples[n-1]
+			if last.State == refuge.StateHeating || last.State == refuge.StateCooling {
+				res.Runtime += gap
+			}
+			res.comfort(s, last.Indoor, gap, tolerance)
+		}
+		if moving {
+			lastMotion = rec.Time
+		}
+		if rec.Motion != nil {
+			moving = rec.Motion.Motion
+			lastMotion = rec.Motion.Time
+		}
+		if rec.Reading == nil {
+			continue
+		}
+		tr := *rec.Reading
+		tr.Time = rec.Time
+		state := g.State()
+		Control(g, s, sb, lastMotion, tr)
+		now := g.State()
+		running := now == refuge.StateHeating || now == refuge.StateCooling
+		if running && now != state {
+			res.Cycles++
+		}
+		stage := 0
+		if st, ok := g.Controller.(Stager); ok {
+			stage, _ = st.Stage()
+		} else if running {
+			stage = 1
+		}
+		res.Samples = append(res.Samples, SimSample{Time: tr.Time, Indoor: tr.Temp, State: now, Stage: stage})
+	}
+	return res
+}
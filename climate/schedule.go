@@ -0,0 +1,38 @@
+package climate
+
+import (
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+const minutesPerWeek = 7 * 24 * 60
+
+// ActiveBlock returns the schedule block in effect at now, in now's location.
+// That is the last block to start at or before now, wrapping around to the end of the previous week.
+// Returns false if the schedule has no blocks.
+func ActiveBlock(s refuge.Schedule, now time.Time) (refuge.ScheduleBlock, bool) {
+	if len(s.Blocks) == 0 {
+		return refuge.ScheduleBlock{}, false
+	}
+	at := weekMinute(int(now.Weekday()), now.Hour()*60+now.Minute())
+	best, bestAgo := 0, minutesPerWeek
+	for i, b := range s.Blocks {
+		ago := (at - weekMinute(int(b.Day), int(b.Minute)) + minutesPerWeek) % minutesPerWeek
+		if ago < bestAgo {
+			best, bestAgo = i, ago
+		}
+	}
+	return s.Blocks[best], true
+}
+
+// weekMinute returns the minute of the week, clamping out of range days and minutes.
+func weekMinute(day, minute int) int {
+	if day > 6 {
+		day = 6
+	}
+	if minute >= 24*60 {
+		minute = 24*60 - 1
+	}
+	return day*24*60 + minute
+}
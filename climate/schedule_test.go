@@ -0,0 +1,47 @@
+package climate
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+func TestActiveBlock(t *testing.T) {
+	// Blocks are out of order, and identified by their Low.
+	week := refuge.Schedule{Blocks: []refuge.ScheduleBlock{
+		{Day: 6, Minute: 23 * 60, Settings: refuge.Settings{Low: 16}},
+		{Day: 1, Minute: 6 * 60, Settings: refuge.Settings{Low: 20}},
+		{Day: 6, Minute: 8 * 60, Settings: refuge.Settings{Low: 21}},
+		{Day: 1, Minute: 22 * 60, Settings: refuge.Settings{Low: 17}},
+	}}
+	// January 5th 2020 is a Sunday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, 1, 5+day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		sched refuge.Schedule
+		now   time.Time
+		low   float32
+		ok    bool
+	}{
+		{"empty", refuge.Schedule{}, at(1, 12, 0), 0, false},
+		{"start of a block", week, at(1, 6, 0), 20, true},
+		{"minute before a block", week, at(1, 5, 59), 16, true},
+		{"during the day", week, at(1, 15, 30), 20, true},
+		{"later block the same day", week, at(1, 23, 0), 17, true},
+		{"days after the last block", week, at(4, 12, 0), 17, true},
+		{"saturday", week, at(6, 9, 0), 21, true},
+		{"sunday early morning wraps to saturday", week, at(0, 3, 0), 16, true},
+		{"sunday midnight", week, at(0, 0, 0), 16, true},
+		{"single block", refuge.Schedule{Blocks: week.Blocks[1:2]}, at(0, 1, 0), 20, true},
+	}
+	for _, tt := range tests {
+		b, ok := ActiveBlock(tt.sched, tt.now)
+		if ok != tt.ok || b.Settings.Low != tt.low {
+			t.Errorf("%s: got low %.0f (%v), want %.0f (%v)", tt.name, b.Settings.Low, ok, tt.low, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package climate
+
+import (
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// DefaultSetback widens the temp range by 2C once there has been no motion for 30 minutes.
+var DefaultSetback = refuge.Setback{
+	Enabled:     true,
+	AwayMinutes: 30,
+	Heat:        2,
+	Cool:        2,
+}
+
+// Away returns true if the setback is enabled and no motion has been seen for its away delay.
+func Away(sb refuge.Setback, lastMotion time.Time, now time.Time) bool {
+	return sb.Enabled && now.Sub(lastMotion) > time.Duration(sb.AwayMinutes)*time.Minute
+}
@@ -0,0 +1,183 @@
+package climate
+
+import (
+	"math"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// House is a simulated house to try out Control on. It implements Stager, so the heating/cooling it
+// is told to run warms/cools it, while the outdoor temp pulls it towards outside through the walls.
+// Call Step to move the simulation forward and Reading to read the indoor temp.
+type House struct {
+	Temp    float32                 // Indoor temp (C)
+	Mass    float32                 // Thermal mass of the air, walls and furniture (kJ per C)
+	Loss    float32                 // Heat lost through the walls (kW per C between indoors and outdoors)
+	Outdoor func(time.Time) float32 // Outdoor temp (C) over time
+	Now     time.Time               // Time of the simulation
+
+	HeatStage float32 // Heat added by each heating stage (kW)
+	CoolStage float32 // Heat removed by each cooling stage (kW)
+	AuxHeat   float32 // Heat added by the aux heat (kW), 0 if there is none
+	NumStages int     // Stages of heating/cooling, not counting aux heat
+
+	Cycles  int           // Times heating/cooling was started
+	Runtime time.Duration // Time spent heating/cooling
+
+	state     refuge.ControlState
+	stage     int
+	emergency bool
+}
+
+// NewHouse creates a typical single stage house at the given temps, starting at start.
+func NewHouse(indoor float32, outdoor func(time.Time) float32, start time.Time) *House {
+	return &House{
+		Temp:      indoor,
+		Mass:      10000,
+		Loss:      0.25,
+		Outdoor:   outdoor,
+		Now:       start,
+		HeatStage: 10,
+		CoolStage: 5,
+		NumStages: 1,
+	}
+}
+
+// DailyOutdoor is an outdoor temp profile that swings between low at 5am and high at 5pm every day.
+func DailyOutdoor(low, high float32) func(time.Time) float32 {
+	return func(t time.Time) float32 {
+		hours := float64(t.Hour()) + float64(t.Minute())/60 - 17
+		return low + (high-low)*float32(1+math.Cos(hours*math.Pi/12))/2
+	}
+}
+
+func (h *House) Heat() { h.run(refuge.StateHeating, false) }
+func (h *House) Cool() { h.run(refuge.StateCooling, false) }
+func (h *House) Fan()  { h.state, h.stage, h.emergency = refuge.StateFanning, 0, false }
+func (h *House) Off()  { h.state, h.stage, h.emergency = refuge.StateIdle, 0, false }
+
+// EmergencyHeat implements Stager.
+func (h *House) EmergencyHeat() { h.run(refuge.StateHeating, true) }
+
+func (h *House) State() refuge.ControlState { return h.state }
+
+// Stages implements Stager.
+func (h *House) Stages(state refuge.ControlState) int {
+	if state == refuge.StateHeating && h.AuxHeat > 0 {
+		return h.NumStages + 1
+	}
+	return h.NumStages
+}
+
+// SetStage implements Stager.
+func (h *House) SetStage(stage int) {
+	if max := h.Stages(h.state); stage > max {
+		stage = max
+	}
+	h.stage = stage
+}
+
+// Stage implements Stager.
+func (h *House) Stage() (int, bool) {
+	return h.stage, h.state == refuge.StateHeating && (h.emergency || h.stage > h.NumStages)
+}
+
+func (h *House) run(state refuge.ControlState, emergency bool) {
+	if h.state != state {
+		h.Cycles++
+	}
+	h.state, h.stage, h.emergency = state, 1, emergency
+}
+
+// power returns the heat (kW) the heating/cooling is adding, negative while cooling.
+func (h *House) power() float32 {
+	switch {
+	case h.state == refuge.StateHeating && h.emergency:
+		return h.AuxHeat
+	case h.state == refuge.StateHeating:
+		stages, aux := h.stage, float32(0)
+		if stages > h.NumStages {
+			stages, aux = h.NumStages, h.AuxHeat
+		}
+		return float32(stages)*h.HeatStage + aux
+	case h.state == refuge.StateCooling:
+		return -float32(h.stage) * h.CoolStage
+	}
+	return 0
+}
+
+// Step moves the simulation forward by d, in steps of at most a minute.
+func (h *House) Step(d time.Duration) {
+	for d > 0 {
+		dt := d
+		if dt > time.Minute {
+			dt = time.Minute
+		}
+		loss := h.Loss * (h.Temp - h.Outdoor(h.Now))
+		h.Temp += (h.power() - loss) * float32(dt.Seconds()) / h.Mass
+		if h.state == refuge.StateHeating || h.state == refuge.StateCooling {
+			h.Runtime += dt
+		}
+		h.Now = h.Now.Add(dt)
+		d -= dt
+	}
+}
+
+// Reading returns a reading of the indoor temp at the current time of the simulation.
+func (h *House) Reading() sensor.ThermalReading {
+	return sensor.ThermalReading{Temp: h.Temp, Humi: 40, Time: h.Now}
+}
+
+// SimSample is the state of a simulation at one step.
+type SimSample struct {
+	Time    time.Time
+	Outdoor float32
+	Indoor  float32
+	State   refuge.ControlState
+	Stage   int
+}
+
+// SimResult is how Control did over a simulation.
+type SimResult struct {
+	Samples   []SimSample
+	Cycles    int           // Times heating/cooling was started
+	Runtime   time.Duration // Time spent heating/cooling
+	Violation time.Duration // Time spent further than the tolerance outside the settings
+	Worst     float32       // Furthest (C) the temp got outside the settings
+}
+
+// Simulate runs Control on the house every step for the given length, with someone home the whole time.
+// Comfort violations are counted while the temp is more than tolerance (C) outside the low/high settings.
+func Simulate(g *Guard, h *House, s refuge.Settings, sb refuge.Setback, length, step time.Duration, tolerance float32) SimResult {
+	res := SimResult{}
+	cycles, runtime := h.Cycles, h.Runtime
+	end := h.Now.Add(length)
+	for h.Now.Before(end) {
+		Control(g, s, sb, h.Now, h.Reading())
+		stage, _ := h.Stage()
+		res.Samples = append(res.Samples, SimSample{Time: h.Now, Outdoor: h.Outdoor(h.Now), Indoor: h.Temp, State: h.State(), Stage: stage})
+
+		res.comfort(s, h.Temp, step, tolerance)
+		h.Step(step)
+	}
+	res.Cycles, res.Runtime = h.Cycles-cycles, h.Runtime-runtime
+	return res
+}
+
+// comfort adds how far the temp is outside the settings for d to the violations.
+func (res *SimResult) comfort(s refuge.Settings, temp float32, d time.Duration, tolerance float32) {
+	off := float32(0)
+	if temp < s.Low {
+		off = s.Low - temp
+	} else if temp > s.High {
+		off = temp - s.High
+	}
+	if off > res.Worst {
+		res.Worst = off
+	}
+	if off > tolerance {
+		res.Violation += d
+	}
+}
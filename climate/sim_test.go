@@ -0,0 +1,81 @@
+package climate
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// runs returns how long each finished heating/cooling run and each rest between two runs lasted.
+func runs(samples []SimSample) (on, off []time.Duration) {
+	type change struct {
+		at      time.Time
+		running bool
+	}
+	changes := []change{}
+	for i, s := range samples {
+		running := s.State == refuge.StateHeating || s.State == refuge.StateCooling
+		if i > 0 && running != (samples[i-1].State == refuge.StateHeating || samples[i-1].State == refuge.StateCooling) {
+			changes = append(changes, change{s.Time, running})
+		}
+	}
+	for i := 1; i < len(changes); i++ {
+		if d := changes[i].at.Sub(changes[i-1].at); changes[i-1].running {
+			on = append(on, d)
+		} else {
+			off = append(off, d)
+		}
+	}
+	return on, off
+}
+
+func TestSimulateDay(t *testing.T) {
+	tests := []struct {
+		name             string
+		indoor           float32
+		outLow, outHigh  float32
+		minRuns, maxRuns int
+		state            refuge.ControlState
+	}{
+		{name: "winter", indoor: 21, outLow: -5, outHigh: 8, minRuns: 5, maxRuns: 30, state: refuge.StateHeating},
+		{name: "summer", indoor: 22, outLow: 22, outHigh: 38, minRuns: 1, maxRuns: 30, state: refuge.StateCooling},
+		{name: "mild", indoor: 21, outLow: 19, outHigh: 24, maxRuns: 0},
+	}
+	s := refuge.Settings{Low: 19, High: 25, Mode: refuge.ModeAuto}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			h := NewHouse(tt.indoor, DailyOutdoor(tt.outLow, tt.outHigh), start)
+			g := NewGuard(h, DefaultOptions)
+			g.Quiet = true
+			res := Simulate(g, h, s, refuge.Setback{}, 24*time.Hour, time.Minute, 1)
+
+			if len(res.Samples) != 24*60 {
+				t.Fatalf("got %d samples, want one a minute", len(res.Samples))
+			}
+			if res.Violation > 0 {
+				t.Errorf("temp was more than 1C outside the settings for %s (worst %.1fC)", res.Violation, res.Worst)
+			}
+			if res.Cycles < tt.minRuns || res.Cycles > tt.maxRuns {
+				t.Errorf("%d cycles, want %d to %d", res.Cycles, tt.minRuns, tt.maxRuns)
+			}
+			for _, sm := range res.Samples {
+				if sm.State != refuge.StateIdle && sm.State != tt.state {
+					t.Fatalf("state %d at %s", sm.State, sm.Time.Format("15:04"))
+				}
+			}
+			on, off := runs(res.Samples)
+			for _, d := range on {
+				if d < DefaultOptions.MinRun {
+					t.Errorf("ran for %s, under the min run", d)
+				}
+			}
+			for _, d := range off {
+				if d < DefaultOptions.MinOff {
+					t.Errorf("rested for %s, under the min off", d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// Config declares everything wired to this pi.
+// Each entry in Devices is published as its own refuge.Device.
+type Config struct {
+	KeyFile          string // File holding the shared household key used to sign messages.
+	Encrypt          bool   // Encrypt all messages with the household key and drop any that aren't encrypted.
+	HeartbeatSeconds int    // How often to send a heartbeat to listeners, 0 to disable.
+	GPIO             string // gpio backend: auto, rpio, chip, /dev/gpiochipN or fake.
+	Devices          []DeviceConfig
+}
+
+// DeviceConfig is a single device. It can have any mix of capabilities.
+// A pin of 0 means it isn't connected.
+type DeviceConfig struct {
+	Name string
+	ID   string // Optional, by default an ID is generated and stored next to the config file (<config>.<name>.id).
+
+	Switch      *SwitchConfig
+	Portal      *PortalConfig
+	Thermometer *ThermometerConfig
+	Thermostat  *ThermostatConfig // Requires a Thermometer on the same device, uses its Motion if there is one.
+	Motion      *MotionConfig
+}
+
+// SwitchConfig is a relay turning something on/off.
+type SwitchConfig struct {
+	Pin int // Output pin driving the relay.
+}
+
+// PortalConfig is a door/window, optionally with an opener and a lock.
+type PortalConfig struct {
+	ControlPin    int // Output pin to trigger the opener.
+	ClosedPin     int // Input pin reading if the portal is closed (high is closed).
+	OpenPin       int // Input pin for a second limit switch reading if the portal is fully open (high is open).
+	LockPin       int // Output pin driving the lock actuator (low is locked).
+	LockSensorPin int // Input pin reading if the lock is engaged (high is locked).
+	TravelSeconds int // How long the portal may take to open/close before it is considered obstructed.
+}
+
+// ThermometerConfig is a temp sensor: a DHT on a pin, a DS18B20 on the 1-wire bus or a BME280 on an i2c bus.
+type ThermometerConfig struct {
+	Sensor      string // dht22 (default), dht11, am2302, ds18b20 or bme280.
+	Pin         int    // Data pin of a DHT.
+	W1ID        string // ID (28-xxxxxxxxxxxx) of a DS18B20, the first one found if empty.
+	I2CBus      string // I2C bus device of a BME280, /dev/i2c-1 if empty.
+	I2CAddr     uint16 // I2C address of a BME280, 0x76 (118) if 0.
+	ReadSeconds int    // How often to read the sensor.
+
+	// Calibration of the raw readings: raw*Scale + Offset. A scale of 0 is 1.
+	TempOffset float32
+	TempScale  float32
+	HumiOffset float32
+	HumiScale  float32
+
+	Filter          string // Smoothing of the calibrated readings: none, median[:n], ema[:weight] or kalman[:q[:r]]. Defaults to median:3.
+	CalibrationFile string // Where a calibration set from the UI is saved, it replaces the one above. Defaults to '<config>.<name>.cal'.
+}
+
+// dht returns true if the sensor is a DHT read on Pin.
+func (tc *ThermometerConfig) dht() bool {
+	return sensor.IsDHT(tc.Sensor)
+}
+
+// calibration returns the configured calibration.
+func (tc *ThermometerConfig) calibration() sensor.Calibration {
+	return sensor.Calibration{TempOffset: tc.TempOffset, TempScale: tc.TempScale, HumiOffset: tc.HumiOffset, HumiScale: tc.HumiScale}
+}
+
+// sensorConfig returns the config to open the sensor with.
+func (tc *ThermometerConfig) sensorConfig(board gpio.Board) sensor.Config {
+	c := sensor.Config{Kind: tc.Sensor, W1ID: tc.W1ID, I2CBus: tc.I2CBus, I2CAddr: tc.I2CAddr}
+	if tc.dht() {
+		c.Pin = board.Pin(tc.Pin)
+	}
+	return c
+}
+
+// ThermostatConfig is the heating/cooling system.
+// Single stage systems only need the heat, cool and fan pins. Anything else needs an Equipment profile.
+type ThermostatConfig struct {
+	HeatPin   int
+	CoolPin   int
+	FanPin    int
+	Equipment *climate.Equipment // Replaces the pins above if set.
+
+	Hysteresis    float32 // How far (C) past the low/high setting before heating/cooling starts.
+	Overshoot     float32 // How far (C) past the low/high setting to keep heating/cooling before stopping.
+	MinRunSeconds int     // Minimum time heating/cooling runs once started.
+	MinOffSeconds int     // Minimum time heating/cooling stays off once stopped.
+	StageDelta    float32 // Add a heating/cooling stage for every this many C the temp is from the setting.
+	StageMinutes  int     // Add a heating/cooling stage when the current one has run this long.
+
+	FreezeLimit          float32 // Heat below this temp (C) no matter the settings.
+	OverTempLimit        float32 // Never heat above this temp (C).
+	SensorTimeoutMinutes int     // Turn everything off when there has been no good temp reading for this long, 0 to disable.
+
+	StateFile string // Where settings and schedule are saved across restarts, defaults to '<config>.<name>.state'.
+	Occupancy string // Motion sensors the away setback goes by: local (default), room or house (from the server).
+
+	Sources      []refuge.TempSource // Remote thermometers to control on instead of the device's own, from the server.
+	StaleMinutes int                 // Fall back to the device's own thermometer once remote readings are this old.
+}
+
+// UnmarshalJSON fills in the climate.DefaultOptions for anything not in the config.
+func (tc *ThermostatConfig) UnmarshalJSON(data []byte) error {
+	type plain ThermostatConfig // Without the UnmarshalJSON method
+	p := plain{
+		Hysteresis:    climate.DefaultOptions.Hysteresis,
+		Overshoot:     climate.DefaultOptions.Overshoot,
+		MinRunSeconds: int(climate.DefaultOptions.MinRun.Seconds()),
+		MinOffSeconds: int(climate.DefaultOptions.MinOff.Seconds()),
+		StageDelta:    climate.DefaultOptions.StageDelta,
+		StageMinutes:  int(climate.DefaultOptions.StageTime.Minutes()),
+		StaleMinutes:  int(device.DefaultStale.Minutes()),
+
+		FreezeLimit:          climate.DefaultOptions.Freeze,
+		OverTempLimit:        climate.DefaultOptions.OverTemp,
+		SensorTimeoutMinutes: int(climate.DefaultOptions.SensorTimeout.Minutes()),
+	}
+	err := json.Unmarshal(data, &p)
+	*tc = ThermostatConfig(p)
+	return err
+}
+
+// options returns the climate options of the thermostat.
+func (tc *ThermostatConfig) options() climate.Options {
+	return climate.Options{
+		Hysteresis: tc.Hysteresis,
+		Overshoot:  tc.Overshoot,
+		MinRun:     time.Duration(tc.MinRunSeconds) * time.Second,
+		MinOff:     time.Duration(tc.MinOffSeconds) * time.Second,
+		StageDelta: tc.StageDelta,
+		StageTime:  time.Duration(tc.StageMinutes) * time.Minute,
+
+		Freeze:        tc.FreezeLimit,
+		OverTemp:      tc.OverTempLimit,
+		SensorTimeout: time.Duration(tc.SensorTimeoutMinutes) * time.Minute,
+	}
+}
+
+// equipment returns the equipment profile of the thermostat.
+func (tc *ThermostatConfig) equipment() climate.Equipment {
+	if tc.Equipment != nil {
+		return *tc.Equipment
+	}
+	return climate.SingleStage(tc.HeatPin, tc.CoolPin, tc.FanPin)
+}
+
+// MotionConfig is a motion sensor.
+type MotionConfig struct {
+	Pin            int // Input pin, high when there is motion.
+	DebounceMillis int // How long the pin has to hold a level before it counts, 50ms if 0.
+	HoldSeconds    int // Motion ends once the pin has been low this long, 30 seconds if 0.
+}
+
+// times returns the debounce and hold times, filling in the defaults.
+func (mc *MotionConfig) times() (time.Duration, time.Duration) {
+	debounce, hold := sensor.DefaultDebounce, sensor.DefaultMotionHold
+	if mc.DebounceMillis > 0 {
+		debounce = time.Duration(mc.DebounceMillis) * time.Millisecond
+	}
+	if mc.HoldSeconds > 0 {
+		hold = time.Duration(mc.HoldSeconds) * time.Second
+	}
+	return debounce, hold
+}
+
+func loadConfig(path string) (Config, error) {
+	cfg := Config{HeartbeatSeconds: int(time.Minute.Seconds()), GPIO: "auto"}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	for i := range cfg.Devices {
+		d := &cfg.Devices[i]
+		if d.Portal != nil && d.Portal.TravelSeconds == 0 {
+			d.Portal.TravelSeconds = 20
+		}
+		if d.Thermometer != nil && d.Thermometer.ReadSeconds == 0 {
+			d.Thermometer.ReadSeconds = 120
+		}
+	}
+	return cfg, err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+func main() {
+	configPath := flag.String("config", "device.json", "config file declaring the devices wired to this pi")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Failed to load config %s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+	if err := validate(cfg); err != nil {
+		fmt.Printf("Invalid config %s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+	rnet.LoadKey(cfg.KeyFile)
+	rnet.RequireEncryption(cfg.Encrypt)
+
+	// Now just hang out until CTRL+C
+	ctx := device.UntilInterrupt()
+
+	board := gpio.OpenOrFake(cfg.GPIO)
+	defer board.Close()
+	if fake, ok := board.(*gpio.Fake); ok {
+		for _, dc := range cfg.Devices {
+			if dc.Thermometer != nil && dc.Thermometer.dht() {
+				sensor.FakeDHT(fake.FakePin(dc.Thermometer.Pin), sensor.DHTModelOf(dc.Thermometer.Sensor))
+			}
+			if dc.Motion != nil {
+				fake.FakePin(dc.Motion.Pin).Set(true)
+			}
+		}
+	}
+
+	heartbeat := time.Duration(cfg.HeartbeatSeconds) * time.Second
+	wg := sync.WaitGroup{}
+	for _, dc := range cfg.Devices {
+		prefix := *configPath + "." + fileName(dc.Name)
+		id := dc.ID
+		if id == "" {
+			id = rnet.LoadID(prefix + ".id")
+		}
+		if dc.Thermostat != nil && dc.Thermostat.StateFile == "" {
+			dc.Thermostat.StateFile = prefix + ".state"
+		}
+		if dc.Thermometer != nil && dc.Thermometer.CalibrationFile == "" {
+			dc.Thermometer.CalibrationFile = prefix + ".cal"
+		}
+		fmt.Printf("Starting device %s (%s)\n", dc.Name, id)
+		node := rnet.NewNode(&refuge.Device{Name: dc.Name, ID: id}, heartbeat)
+		caps, err := capabilities(dc, board)
+		if err != nil {
+			fmt.Printf("Failed to set up device %s: %s\n", dc.Name, err)
+			os.Exit(1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			device.Run(ctx, node, time.Millisecond*100, caps...)
+		}()
+	}
+	wg.Wait()
+}
+
+// validate checks the config for devices that can't be run.
+func validate(cfg Config) error {
+	if len(cfg.Devices) == 0 {
+		return fmt.Errorf("no devices configured")
+	}
+	names := map[string]bool{}
+	for _, dc := range cfg.Devices {
+		if dc.Name == "" {
+			return fmt.Errorf("every device needs a name")
+		}
+		// Names that only differ by spaces would share the same ID and state files.
+		if names[fileName(dc.Name)] {
+			return fmt.Errorf("device name %s is used more than once (ignoring spaces)", dc.Name)
+		}
+		names[fileName(dc.Name)] = true
+		if (dc.Switch != nil && dc.Switch.Pin == 0) || (dc.Thermometer != nil && dc.Thermometer.dht() && dc.Thermometer.Pin == 0) || (dc.Motion != nil && dc.Motion.Pin == 0) {
+			return fmt.Errorf("device %s is missing a pin", dc.Name)
+		}
+		if pc := dc.Portal; pc != nil && pc.ControlPin == 0 && pc.ClosedPin == 0 && pc.OpenPin == 0 && pc.LockPin == 0 && pc.LockSensorPin == 0 {
+			return fmt.Errorf("portal %s has no pins", dc.Name)
+		}
+		if dc.Thermometer != nil {
+			if _, err := sensor.ParseFilter(dc.Thermometer.Filter); err != nil {
+				return fmt.Errorf("thermometer %s: %s", dc.Name, err)
+			}
+		}
+		if dc.Thermostat != nil && dc.Thermometer == nil {
+			return fmt.Errorf("thermostat %s needs a thermometer", dc.Name)
+		}
+		if dc.Thermostat != nil {
+			if _, err := device.ParseOccupancy(dc.Thermostat.Occupancy); err != nil {
+				return fmt.Errorf("thermostat %s: %s", dc.Name, err)
+			}
+		}
+		if dc.Switch == nil && dc.Portal == nil && dc.Thermometer == nil && dc.Motion == nil {
+			return fmt.Errorf("device %s has nothing attached", dc.Name)
+		}
+	}
+	return nil
+}
+
+// fileName is the name of the device used in the names of its ID and state files.
+func fileName(name string) string {
+	return strings.Replace(name, " ", "", -1)
+}
+
+// capabilities sets up the pins and sensors of the device and returns the capabilities to run it with.
+func capabilities(dc DeviceConfig, board gpio.Board) ([]device.Capability, error) {
+	caps := []device.Capability{}
+	if dc.Switch != nil {
+		caps = append(caps, device.NewSwitch(board.Pin(dc.Switch.Pin)))
+	}
+	if pc := dc.Portal; pc != nil {
+		pins := device.PortalPins{
+			Control:    gpio.Optional(board, pc.ControlPin),
+			Closed:     gpio.Optional(board, pc.ClosedPin),
+			Open:       gpio.Optional(board, pc.OpenPin),
+			Lock:       gpio.Optional(board, pc.LockPin),
+			LockSensor: gpio.Optional(board, pc.LockSensorPin),
+		}
+		caps = append(caps, device.NewPortal(pins, time.Duration(pc.TravelSeconds)*time.Second))
+	}
+
+	var motion *device.Motion
+	if dc.Motion != nil {
+		debounce, hold := dc.Motion.times()
+		motion = device.NewMotion(board.Pin(dc.Motion.Pin), debounce, hold)
+	}
+	var therm *device.Thermometer
+	if dc.Thermometer != nil {
+		s, err := sensor.Open(dc.Thermometer.sensorConfig(board))
+		if err != nil {
+			return nil, err
+		}
+		therm = device.NewThermometer(s, time.Duration(dc.Thermometer.ReadSeconds)*time.Second)
+		filter, _ := sensor.ParseFilter(dc.Thermometer.Filter) // Checked by validate.
+		therm.UsePipeline(dc.Thermometer.calibration(), filter)
+		therm.Persist(dc.Thermometer.CalibrationFile)
+	}
+	if tc := dc.Thermostat; tc != nil {
+		// The thermostat drives its own thermometer and motion sensor.
+		cl := climate.NewEquipmentController(board, tc.equipment())
+		thermostat := device.NewThermostat(cl, tc.options(), therm, motion)
+		occ, _ := device.ParseOccupancy(tc.Occupancy) // Checked by validate.
+		thermostat.UseOccupancy(occ)
+		if len(tc.Sources) > 0 {
+			thermostat.UseSources(tc.Sources, time.Duration(tc.StaleMinutes)*time.Minute)
+		}
+		thermostat.Persist(tc.StateFile)
+		return append(caps, thermostat), nil
+	}
+	if therm != nil {
+		caps = append(caps, therm)
+	}
+	if motion != nil {
+		caps = append(caps, motion)
+	}
+	return caps, nil
+}
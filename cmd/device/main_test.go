@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices []DeviceConfig
+		ok      bool
+	}{
+		{"switch", []DeviceConfig{{Name: "Lamp", Switch: &SwitchConfig{Pin: 4}}}, true},
+		{"no devices", nil, false},
+		{"no name", []DeviceConfig{{Switch: &SwitchConfig{Pin: 4}}}, false},
+		{"nothing attached", []DeviceConfig{{Name: "Lamp"}}, false},
+		{"switch without pin", []DeviceConfig{{Name: "Lamp", Switch: &SwitchConfig{}}}, false},
+		{"portal without pins", []DeviceConfig{{Name: "Door", Portal: &PortalConfig{TravelSeconds: 20}}}, false},
+		{"portal with sensor only", []DeviceConfig{{Name: "Door", Portal: &PortalConfig{ClosedPin: 17}}}, true},
+		{"same name", []DeviceConfig{
+			{Name: "Living Room", Switch: &SwitchConfig{Pin: 4}},
+			{Name: "Living Room", Switch: &SwitchConfig{Pin: 5}},
+		}, false},
+		{"same name without spaces", []DeviceConfig{
+			{Name: "Living Room", Switch: &SwitchConfig{Pin: 4}},
+			{Name: "LivingRoom", Switch: &SwitchConfig{Pin: 5}},
+		}, false},
+		{"thermostat without thermometer", []DeviceConfig{{Name: "Hall", Thermostat: &ThermostatConfig{}}}, false},
+	}
+	for _, tt := range tests {
+		err := validate(Config{Devices: tt.devices})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
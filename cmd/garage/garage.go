@@ -6,83 +6,73 @@ import (
 	"os"
 	"time"
 
-	rpio "github.com/stianeikeland/go-rpio"
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
 	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
 )
 
 func main() {
-	cpin := flag.Int("cpin", 24, "input pin to control")
-	spin := flag.Int("spin", 4, "input pin to read if portal is open")
+	cpin := flag.Int("cpin", 24, "output pin to trigger the opener, 0 if the portal can't be opened (house doors)")
+	spin := flag.Int("spin", 4, "input pin to read if portal is closed (high is closed)")
+	opin := flag.Int("opin", 0, "optional input pin for a second limit switch that reads if portal is fully open (high is open)")
+	travel := flag.Duration("travel", time.Second*20, "how long the portal may take to open/close before it is considered obstructed")
+	lpin := flag.Int("lpin", 0, "output pin to drive the lock actuator (low is locked), 0 if there is no lock")
+	lspin := flag.Int("lspin", 0, "input pin to read if the lock is engaged (high is locked), 0 if there is no lock sensor")
 	name := flag.String("name", "", "name of portal")
+	keyfile := flag.String("keyfile", "", "file holding the shared household key used to sign messages")
+	encrypt := flag.Bool("encrypt", false, "encrypt all messages with the household key and drop any that aren't encrypted")
+	backend := flag.String("gpio", "auto", "gpio backend: auto, rpio, chip, /dev/gpiochipN or fake")
+	heartbeat := flag.Duration("heartbeat", time.Minute, "how often to send a heartbeat to listeners, 0 to disable")
 	flag.Parse()
+	rnet.LoadKey(*keyfile)
+	rnet.RequireEncryption(*encrypt)
 
-	fmt.Printf("Name: %s, Control Pin: %d, Sensor Pin: %d\n", *name, *cpin, *spin)
+	fmt.Printf("Name: %s, Control Pin: %d, Sensor Pin: %d, Open Sensor Pin: %d, Lock Pin: %d, Lock Sensor Pin: %d\n", *name, *cpin, *spin, *opin, *lpin, *lspin)
 	if *name == "" {
 		fmt.Printf("Name parameter is required.")
 		os.Exit(1)
 	}
-	run(*name, *cpin, *spin)
+	run(*name, *cpin, *spin, *opin, *lpin, *lspin, *travel, *backend, *heartbeat)
 }
 
-func run(name string, cpin int, spin int) {
-	poll := setupNetwork(name)
+func run(name string, cpin, spin, opin, lpin, lspin int, travel time.Duration, backend string, heartbeat time.Duration) {
+	node := rnet.NewNode(&refuge.Device{Name: name}, heartbeat)
 
-	state := refuge.PortalStateUnknown
+	// Now just hang out until CTRL+C
+	ctx := device.UntilInterrupt()
 
-	err := rpio.Open()
-	if err != nil {
-		print("Unable to use real pins...\n")
-		for {
-			newState := poll(state)
-			if newState != refuge.PortalStateUnknown && state != newState {
-				fmt.Printf("State is now: %d\n", newState)
-				state = newState
-			}
-			time.Sleep(time.Millisecond * 5)
-		}
+	board := gpio.OpenOrFake(backend)
+	defer board.Close()
+	if fake, ok := board.(*gpio.Fake); ok {
+		simulate(fake, cpin, spin, lpin)
 	}
-	sensor := rpio.Pin(spin)
-	sensor.PullDown()       // Make sure default state is low
-	sensor.Mode(rpio.Input) // Now read for state to go high
-
-	// Set switch to off
-	control := rpio.Pin(cpin)
-	control.Mode(rpio.Output)
-	control.High()
-
-	lastRead := time.Now().Unix()
-	readDelay := int64(2) // seconds
-	for {
-		// 1. try network loop
-		requested := poll(state)
+	pins := device.PortalPins{
+		Control:    gpio.Optional(board, cpin),
+		Closed:     gpio.Optional(board, spin),
+		Open:       gpio.Optional(board, opin),
+		Lock:       gpio.Optional(board, lpin),
+		LockSensor: gpio.Optional(board, lspin),
+	}
+	device.Run(ctx, node, time.Millisecond*200, device.NewPortal(pins, travel))
+}
 
-		// 2. check sensors every "readDelay" seconds
-		if spin > 0 && time.Now().Unix()-lastRead > readDelay {
-			// Check to see if portal is open
-			sr := sensor.Read()
-			if sr == rpio.High {
-				if state != refuge.PortalStateClosed {
-					fmt.Printf("New Door State: Closed\n")
-					state = refuge.PortalStateClosed
-				}
-			} else {
-				if state != refuge.PortalStateOpen {
-					fmt.Printf("New Door State: Open\n")
-					state = refuge.PortalStateOpen
-				}
+// simulate scripts the fake pins as a portal that instantly moves to wherever the opener sends it.
+func simulate(fake *gpio.Fake, cpin, spin, lpin int) {
+	if spin == 0 {
+		return
+	}
+	closed := fake.FakePin(spin)
+	closed.Set(true)
+	if cpin > 0 {
+		fake.FakePin(cpin).OnWrite = func(high bool) {
+			if !high {
+				closed.Set(!closed.Level())
+				fmt.Printf("Portal is now closed: %v\n", closed.Level())
 			}
-			lastRead = time.Now().Unix()
-		}
-
-		// 3. Update state?
-		// If v != current state, trigger the garage to open
-		if requested != refuge.PortalStateUnknown && requested != state {
-			control.Low()
-			time.Sleep(time.Millisecond * 100)
-			control.High()
-			lastRead = time.Now().Unix() - readDelay + 1 // force a re-read in 1 second
-		} else {
-			time.Sleep(time.Millisecond * 200)
 		}
 	}
+	if lpin > 0 {
+		fake.FakePin(lpin).OnWrite = func(high bool) { fmt.Printf("Lock is now locked: %v\n", !high) }
+	}
 }
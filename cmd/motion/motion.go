@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+func main() {
+	mpin := flag.Int("mpin", 4, "input pin to read for motion")
+	debounce := flag.Duration("debounce", sensor.DefaultDebounce, "how long the motion pin has to hold a level before it counts")
+	hold := flag.Duration("hold", sensor.DefaultMotionHold, "motion ends once the motion pin has been low this long")
+	name := flag.String("name", "", "name of motion sensor")
+	keyfile := flag.String("keyfile", "", "file holding the shared household key used to sign messages")
+	encrypt := flag.Bool("encrypt", false, "encrypt all messages with the household key and drop any that aren't encrypted")
+	backend := flag.String("gpio", "auto", "gpio backend: auto, rpio, chip, /dev/gpiochipN or fake")
+	heartbeat := flag.Duration("heartbeat", time.Minute, "how often to send a heartbeat to listeners, 0 to disable")
+	flag.Parse()
+	rnet.LoadKey(*keyfile)
+	rnet.RequireEncryption(*encrypt)
+
+	fmt.Printf("Name: %s, Motion Pin: %d\n", *name, *mpin)
+	if *name == "" {
+		fmt.Printf("Name parameter is required.")
+		os.Exit(1)
+	}
+	run(*name, *mpin, *debounce, *hold, *backend, *heartbeat)
+}
+
+func run(name string, mpin int, debounce, hold time.Duration, backend string, heartbeat time.Duration) {
+	node := rnet.NewNode(&refuge.Device{Name: name}, heartbeat)
+
+	// Now just hang out until CTRL+C
+	ctx := device.UntilInterrupt()
+
+	board := gpio.OpenOrFake(backend)
+	defer board.Close()
+	if fake, ok := board.(*gpio.Fake); ok {
+		fake.FakePin(mpin).Set(true)
+	}
+	device.Run(ctx, node, time.Millisecond*200, device.NewMotion(board.Pin(mpin), debounce, hold))
+}
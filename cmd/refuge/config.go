@@ -14,6 +14,15 @@ type Config struct {
 	Users    map[string]userAccess
 	Mailgun  MailgunConfig
 	StatsDir string
+	Liveness LivenessConfig
+	Key      string // Shared household key used to sign device messages. Empty leaves messages unsigned.
+	Encrypt  bool   // Require device messages to be encrypted with the Key, plaintext messages are dropped.
+}
+
+// LivenessConfig controls when quiet devices are marked inactive and removed.
+type LivenessConfig struct {
+	InactiveMinutes int // Minutes without hearing from a device before it is marked inactive and pinged.
+	RemoveMinutes   int // Minutes without hearing from a device before it is removed from the list.
 }
 
 // MailgunConfig is the settings needed to use Mailgun for emails.
@@ -28,6 +37,10 @@ func loadUserConfig() {
 	globalConfig = Config{
 		Users:    map[string]userAccess{},
 		StatsDir: "./stats",
+		Liveness: LivenessConfig{
+			InactiveMinutes: 10,
+			RemoveMinutes:   60 * 24,
+		},
 	}
 	data, err := ioutil.ReadFile("config.json")
 	if err == nil {
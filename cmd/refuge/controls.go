@@ -3,45 +3,187 @@ package main
 import (
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/lologarithm/netgen/lib/ngservice"
+	"github.com/gorilla/websocket"
 	"gitlab.com/lologarithm/refuge/refuge"
 	"gitlab.com/lologarithm/refuge/rnet"
 )
 
-// This file holds functions to control the various IoT devices via udp messages
-func toggleSwitch(newstate int, conn *net.UDPConn, addr *net.UDPAddr) {
+// This file holds functions to control the various IoT devices via udp messages.
+// Every command carries a request ID and is retried with backoff until the device acks it.
+
+// Retry schedule for commands, the delay doubles after every attempt.
+const (
+	firstRetry  = time.Millisecond * 250
+	maxAttempts = 6
+)
+
+var lastReqID uint64
+
+// pendingCommand is a command sent to a device that hasn't been acked yet.
+type pendingCommand struct {
+	cmd      rnet.Command
+	deviceID string
+	addr     *net.UDPAddr
+	client   *websocket.Conn // client that requested the change, told if the command fails.
+	attempts int
+	delay    time.Duration
+	next     time.Time
+}
+
+// commander tracks all commands that are waiting for an ack.
+type commander struct {
+	conn    *net.UDPConn
+	lock    sync.Mutex
+	pending map[uint64]*pendingCommand
+}
+
+func newCommander(conn *net.UDPConn) *commander {
+	return &commander{conn: conn, pending: map[uint64]*pendingCommand{}}
+}
+
+func toggleSwitch(srv *server, client *websocket.Conn, dev *refugeDevice, newstate int) {
 	log.Printf("Attempting to send switch toggle: %#v", newstate)
-	if conn == nil {
-		log.Printf("[Error] No Connection to device.")
-		return
-	}
-	n, err := conn.WriteToUDP(ngservice.WriteMessage(rnet.Context, refuge.Switch{On: newstate == 1}), addr)
-	if n == 0 || err != nil {
-		log.Printf("[Error] Send failed: %v", err)
+	srv.sendCommand(client, dev, rnet.Command{Switch: &refuge.Switch{On: newstate == 1}})
+}
+
+func togglePortal(srv *server, client *websocket.Conn, dev *refugeDevice, newstate int) {
+	log.Printf("Attempting to send portal toggle: %#v", newstate)
+	srv.sendCommand(client, dev, rnet.Command{Portal: &refuge.Portal{State: refuge.PortalState(newstate)}})
+}
+
+func lockPortal(srv *server, client *websocket.Conn, dev *refugeDevice, newstate int) {
+	log.Printf("Attempting to send lock toggle: %#v", newstate)
+	srv.sendCommand(client, dev, rnet.Command{Portal: &refuge.Portal{Lock: refuge.LockState(newstate)}})
+}
+
+func setTherm(srv *server, client *websocket.Conn, dev *refugeDevice, c refuge.Settings) {
+	log.Printf("Attempting to send therm set request: %#v", c)
+	srv.sendCommand(client, dev, rnet.Command{Settings: &c})
+}
+
+func setSchedule(srv *server, client *websocket.Conn, dev *refugeDevice, s refuge.Schedule) {
+	log.Printf("Attempting to send schedule with %d blocks", len(s.Blocks))
+	srv.sendCommand(client, dev, rnet.Command{Schedule: &s})
+}
+
+func setSetback(srv *server, client *websocket.Conn, dev *refugeDevice, sb refuge.Setback) {
+	log.Printf("Attempting to send setback policy: %#v", sb)
+	srv.sendCommand(client, dev, rnet.Command{Setback: &sb})
+}
+
+func setCalibration(srv *server, client *websocket.Conn, dev *refugeDevice, cal refuge.Calibration) {
+	log.Printf("Attempting to send thermometer calibration: %#v", cal)
+	srv.sendCommand(client, dev, rnet.Command{Calibration: &cal})
+}
+
+// commandKind returns what the command changes. A newer command of the same kind replaces a pending one,
+// commands of different kinds to the same device are all sent.
+func commandKind(cmd rnet.Command) string {
+	switch {
+	case cmd.Switch != nil:
+		return "switch"
+	case cmd.Portal != nil && cmd.Portal.Lock != refuge.LockStateUnknown:
+		return "lock"
+	case cmd.Portal != nil:
+		return "portal"
+	case cmd.Settings != nil:
+		return "settings"
+	case cmd.Schedule != nil:
+		return "schedule"
+	case cmd.Setback != nil:
+		return "setback"
+	case cmd.Calibration != nil:
+		return "calibration"
 	}
+	return ""
 }
 
-func togglePortal(newstate int, conn *net.UDPConn, addr *net.UDPAddr) {
-	log.Printf("Attempting to send switch toggle: %#v", newstate)
-	if conn == nil {
+// sendCommand sends the command to the device and tracks it until it is acked.
+// An older command of the same kind still pending for the device is dropped so a retry can't undo a newer change.
+func (srv *server) sendCommand(client *websocket.Conn, dev *refugeDevice, cmd rnet.Command) {
+	cmd.ReqID = atomic.AddUint64(&lastReqID, 1)
+	pc := &pendingCommand{
+		cmd:      cmd,
+		deviceID: dev.device.ID,
+		addr:     dev.addr,
+		client:   client,
+		delay:    firstRetry,
+	}
+	cm := srv.commands
+	if cm.conn == nil {
 		log.Printf("[Error] No Connection to device.")
+		srv.commandFailed(pc)
 		return
 	}
-	n, err := conn.WriteToUDP(ngservice.WriteMessage(rnet.Context, refuge.Portal{State: refuge.PortalState(newstate)}), addr)
+	cm.lock.Lock()
+	for id, p := range cm.pending {
+		if p.deviceID == pc.deviceID && commandKind(p.cmd) == commandKind(cmd) {
+			delete(cm.pending, id)
+		}
+	}
+	cm.pending[cmd.ReqID] = pc
+	cm.lock.Unlock()
+	cm.send(pc)
+}
+
+// send writes the command to the device and schedules the next retry.
+func (cm *commander) send(pc *pendingCommand) {
+	pc.attempts++
+	pc.next = time.Now().Add(pc.delay)
+	pc.delay *= 2
+	n, err := rnet.WriteTo(cm.conn, &pc.cmd, pc.addr)
 	if n == 0 || err != nil {
 		log.Printf("[Error] Send failed: %v", err)
 	}
 }
 
-func setTherm(c refuge.Settings, conn *net.UDPConn, addr *net.UDPAddr) {
-	log.Printf("Attempting to send therm set request: %#v", c)
-	if conn == nil {
-		log.Printf("[Error] No Connection to device.")
-		return
+// ack marks the command as done.
+func (cm *commander) ack(reqID uint64) {
+	cm.lock.Lock()
+	delete(cm.pending, reqID)
+	cm.lock.Unlock()
+}
+
+// retryCommands resends commands that haven't been acked in time.
+// Commands that are never acked are reported back to the client that sent them.
+func (srv *server) retryCommands() {
+	cm := srv.commands
+	for {
+		time.Sleep(firstRetry / 5)
+		failed := []*pendingCommand{}
+		now := time.Now()
+		cm.lock.Lock()
+		for id, pc := range cm.pending {
+			if now.Before(pc.next) {
+				continue
+			}
+			if pc.attempts >= maxAttempts {
+				delete(cm.pending, id)
+				failed = append(failed, pc)
+				continue
+			}
+			log.Printf("No ack for request %d to device %s, retrying.", id, pc.deviceID)
+			cm.send(pc)
+		}
+		cm.lock.Unlock()
+
+		for _, pc := range failed {
+			srv.commandFailed(pc)
+		}
 	}
-	n, err := conn.WriteToUDP(ngservice.WriteMessage(rnet.Context, c), addr)
-	if n == 0 || err != nil {
-		log.Printf("[Error] Send failed: %v", err)
+}
+
+// commandFailed lets the client that requested the change know it never happened.
+func (srv *server) commandFailed(pc *pendingCommand) {
+	log.Printf("[Error] Request %d to device %s was never acknowledged.", pc.cmd.ReqID, pc.deviceID)
+	if pc.client == nil {
+		return
 	}
+	srv.clientslock.Lock()
+	pc.client.WriteJSON(&CommandFailed{Failed: pc.deviceID, Error: "Device did not respond to the request."})
+	srv.clientslock.Unlock()
 }
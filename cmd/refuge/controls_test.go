@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+func TestSendCommandReplaces(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	srv := &server{commands: newCommander(conn), clientslock: &sync.Mutex{}}
+	garage := &refugeDevice{device: refuge.Device{ID: "garage"}, addr: conn.LocalAddr().(*net.UDPAddr)}
+	thermo := &refugeDevice{device: refuge.Device{ID: "thermo"}, addr: conn.LocalAddr().(*net.UDPAddr)}
+
+	togglePortal(srv, nil, garage, int(refuge.PortalStateOpen))
+	lockPortal(srv, nil, garage, int(refuge.LockStateLocked))
+	togglePortal(srv, nil, garage, int(refuge.PortalStateClosed))
+	setTherm(srv, nil, thermo, refuge.Settings{Low: 20, High: 25})
+	setSchedule(srv, nil, thermo, refuge.Schedule{})
+	setSetback(srv, nil, thermo, refuge.Setback{})
+	setCalibration(srv, nil, thermo, refuge.Calibration{})
+	setTherm(srv, nil, thermo, refuge.Settings{Low: 19, High: 25})
+
+	pending := map[string]rnet.Command{}
+	for _, pc := range srv.commands.pending {
+		pending[pc.deviceID+" "+commandKind(pc.cmd)] = pc.cmd
+	}
+	got := []string{}
+	for k := range pending {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	want := []string{"garage lock", "garage portal", "thermo calibration", "thermo schedule", "thermo setback", "thermo settings"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending %v, want %v", got, want)
+	}
+	if state := pending["garage portal"].Portal.State; state != refuge.PortalStateClosed {
+		t.Errorf("pending portal command is %s, want the newer close", state)
+	}
+	if low := pending["thermo settings"].Settings.Low; low != 19 {
+		t.Errorf("pending settings have low %.0f, want the newer 19", low)
+	}
+}
+
+func TestCommandKind(t *testing.T) {
+	tests := []struct {
+		cmd  rnet.Command
+		kind string
+	}{
+		{rnet.Command{Switch: &refuge.Switch{On: true}}, "switch"},
+		{rnet.Command{Portal: &refuge.Portal{State: refuge.PortalStateOpen}}, "portal"},
+		{rnet.Command{Portal: &refuge.Portal{Lock: refuge.LockStateUnlocked}}, "lock"},
+		{rnet.Command{Settings: &refuge.Settings{}}, "settings"},
+		{rnet.Command{Schedule: &refuge.Schedule{}}, "schedule"},
+		{rnet.Command{Setback: &refuge.Setback{}}, "setback"},
+		{rnet.Command{Calibration: &refuge.Calibration{}}, "calibration"},
+	}
+	for _, tt := range tests {
+		if got := commandKind(tt.cmd); got != tt.kind {
+			t.Errorf("%+v is a %q command, want %q", tt.cmd, got, tt.kind)
+		}
+	}
+}
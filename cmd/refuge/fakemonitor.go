@@ -49,6 +49,16 @@ func fakeMonitor() chan rnet.Msg {
 				},
 			}
 			time.Sleep(3 * time.Second)
+			tstream <- rnet.Msg{
+				Device: &refuge.Device{
+					Name: "Test Front Door",
+					Portal: &refuge.Portal{
+						State: refuge.PortalStateClosed,
+						Lock:  refuge.LockState(i%2 + 1),
+					},
+				},
+			}
+			time.Sleep(3 * time.Second)
 			i++
 		}
 	}()
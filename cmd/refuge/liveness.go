@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// livenessMonitor periodically checks when we last heard from each device.
+// Devices that have been quiet for too long are marked inactive and pinged directly.
+// If they still don't respond they are removed from the device list.
+func (srv *server) livenessMonitor(lc LivenessConfig) {
+	inactive := time.Duration(lc.InactiveMinutes) * time.Minute
+	remove := time.Duration(lc.RemoveMinutes) * time.Minute
+	if inactive <= 0 {
+		log.Printf("Device liveness tracking disabled.")
+		return
+	}
+	checkInterval := inactive / 4
+	if checkInterval > time.Minute {
+		checkInterval = time.Minute
+	}
+
+	for {
+		time.Sleep(checkInterval)
+
+		updates := []*DeviceUpdate{}
+		removed := []string{}
+		now := time.Now()
+		srv.datalock.Lock()
+		for id, dev := range srv.Devices {
+			quiet := now.Sub(dev.lastSeen)
+			if remove > 0 && quiet > remove {
+				log.Printf("Haven't heard from device %s (%s) since %s, removing it.", dev.device.Name, id, dev.lastSeen)
+				delete(srv.Devices, id)
+				removed = append(removed, id)
+				continue
+			}
+			if quiet > inactive && dev.online {
+				log.Printf("Haven't heard from device %s (%s) since %s, marking inactive.", dev.device.Name, id, dev.lastSeen)
+				dev.online = false
+				updates = append(updates, dev.update())
+			}
+			if !dev.online && srv.conn != nil && dev.addr != nil {
+				// Ask the device directly to let us know it's still around.
+				rnet.WriteTo(srv.conn, pingmsg, dev.addr)
+			}
+		}
+		srv.datalock.Unlock()
+
+		for _, up := range updates {
+			srv.pushToClients(up)
+		}
+		for _, id := range removed {
+			srv.notifyRemoved(id)
+		}
+	}
+}
+
+// removeDevice removes the device from the device list and lets all clients know.
+func (srv *server) removeDevice(id string) {
+	srv.datalock.Lock()
+	_, ok := srv.Devices[id]
+	delete(srv.Devices, id)
+	srv.datalock.Unlock()
+	if !ok {
+		return
+	}
+	log.Printf("Removing device %s by request.", id)
+	srv.notifyRemoved(id)
+}
+
+func (srv *server) notifyRemoved(id string) {
+	select {
+	case srv.devRemovals <- id:
+	default:
+		log.Printf("[Error] Alert system isn't keeping up, it will keep watching removed device: %s", id)
+	}
+	srv.pushToClients(&DeviceRemoved{Removed: id})
+}
+
+// heartbeatListener marks devices as seen when their heartbeats arrive.
+// A heartbeat that goes backwards means the device restarted, so we ping it for its full state.
+// It runs until the server is stopped.
+func (srv *server) heartbeatListener(heartbeats chan rnet.Heartbeat) {
+	defer srv.listeners.Done()
+	for {
+		var hb rnet.Heartbeat
+		select {
+		case hb = <-heartbeats:
+		case <-srv.quit:
+			return
+		}
+		srv.datalock.Lock()
+		dev, ok := srv.Devices[hb.ID]
+		if !ok {
+			srv.datalock.Unlock()
+			log.Printf("Heartbeat from unknown device %s, waiting for its state.", hb.ID)
+			continue
+		}
+		restarted := hb.Seq < dev.hbSeq || hb.Uptime < dev.uptime
+		wasOnline := dev.online
+		dev.lastSeen = time.Now()
+		dev.online = true
+		dev.uptime = hb.Uptime
+		dev.hbSeq = hb.Seq
+		up := dev.update()
+		addr := dev.addr
+		srv.datalock.Unlock()
+
+		if restarted {
+			log.Printf("Device %s (%s) restarted, up for %ds.", up.Name, hb.ID, hb.Uptime)
+			if srv.conn != nil && addr != nil {
+				rnet.WriteTo(srv.conn, pingmsg, addr)
+			}
+		}
+		select {
+		case srv.devUpdates <- *up.Device: // let the alert system know it is still alive.
+		default:
+		}
+		if !wasOnline || restarted {
+			srv.pushToClients(up)
+		}
+	}
+}
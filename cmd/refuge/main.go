@@ -2,6 +2,8 @@ package main
 
 import (
 	"flag"
+
+	"gitlab.com/lologarithm/refuge/rnet"
 )
 
 func main() {
@@ -11,6 +13,8 @@ func main() {
 
 	// Setup user access
 	loadUserConfig()
+	rnet.SetKey(globalConfig.Key)
+	rnet.RequireEncryption(globalConfig.Encrypt)
 
 	// Launcher monitors and serves web host.
 	serve(*host, runServer(networkMonitor(*test)))
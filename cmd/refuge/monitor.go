@@ -7,18 +7,29 @@ import (
 	"os"
 	"time"
 
-	"github.com/lologarithm/netgen/lib/ngservice"
 	"gitlab.com/lologarithm/refuge/refuge"
 	"gitlab.com/lologarithm/refuge/rnet"
 )
 
+// netStreams are the streams of messages decoded from the device network.
+type netStreams struct {
+	devices    chan rnet.Msg       // Device state updates
+	heartbeats chan rnet.Heartbeat // Device heartbeats
+	acks       chan rnet.Ack       // Devices acknowledging commands
+	conn       *net.UDPConn        // Connection used to talk to devices, nil when using test data.
+}
+
 // networkMonitor monitors for network messages and decodes/passes them along to the main processor
-// the message channel returned by the function is the stream of messages decoded from the network.
-func networkMonitor(test bool) (chan rnet.Msg, *net.UDPConn) {
+// the streams returned by the function are the messages decoded from the network.
+func networkMonitor(test bool) netStreams {
 	if test {
-		return fakeMonitor(), nil
+		return netStreams{devices: fakeMonitor(), heartbeats: make(chan rnet.Heartbeat), acks: make(chan rnet.Ack)}
+	}
+	ns := netStreams{
+		devices:    make(chan rnet.Msg, 10),
+		heartbeats: make(chan rnet.Heartbeat, 10),
+		acks:       make(chan rnet.Ack, 10),
 	}
-	tstream := make(chan rnet.Msg, 10)
 
 	local, err := net.ResolveUDPAddr("udp", ":0")
 	if err != nil {
@@ -40,35 +51,47 @@ func networkMonitor(test bool) (chan rnet.Msg, *net.UDPConn) {
 		// These will come from devices that first came online
 		// We will ping them directly so they know to update the main server.
 		broadBuf := make([]byte, 2048)
+		seen := rnet.Nonces{}
 		for {
 			n, remoteAddr, _ := broadcasts.ReadFromUDP(broadBuf)
 			if n > 0 {
-				packet, ok := ngservice.ReadPacket(rnet.Context, broadBuf[:n])
+				packet, ok := rnet.ReadPacket(broadBuf[:n], seen)
 				if ok && packet.Header.MsgType == rnet.PingMsgType {
 					if !(packet.NetMsg.(*rnet.Ping)).Respond {
-						udpConn.WriteToUDP(pingmsg, remoteAddr)
+						rnet.WriteTo(udpConn, pingmsg, remoteAddr)
 					}
 				}
 			}
 		}
 	}()
 
-	go readNetwork(udpConn, tstream)
+	ns.conn = udpConn
+	go readNetwork(ns)
 
 	ping(udpConn) // send a ping out to network to find all devices available right now.
 
-	return tstream, udpConn
+	return ns
 }
 
-func readNetwork(udpConn *net.UDPConn, tstream chan rnet.Msg) {
+func readNetwork(ns netStreams) {
+	udpConn, tstream := ns.conn, ns.devices
 	buf := make([]byte, 2048)
+	seen := rnet.Nonces{}
 	var reading *rnet.Msg
 	for {
 		n, _, _ := udpConn.ReadFromUDP(buf)
 		if n > 0 {
-			packet, ok := ngservice.ReadPacket(rnet.Context, buf[:n])
+			packet, ok := rnet.ReadPacket(buf[:n], seen)
 			if ok && packet.Header.MsgType == rnet.MsgMsgType {
 				reading = packet.NetMsg.(*rnet.Msg)
+			} else if ok && packet.Header.MsgType == rnet.HeartbeatMsgType {
+				ns.heartbeats <- *packet.NetMsg.(*rnet.Heartbeat)
+				continue
+			} else if ok && packet.Header.MsgType == rnet.AckMsgType {
+				// Acks carry the new state of the device, so treat it as an update too.
+				ack := packet.NetMsg.(*rnet.Ack)
+				ns.acks <- *ack
+				reading = &rnet.Msg{Device: ack.Device}
 			} else {
 				log.Printf("Failed to read network message... %v", buf[:n])
 				continue
@@ -85,6 +108,10 @@ func readNetwork(udpConn *net.UDPConn, tstream chan rnet.Msg) {
 			log.Printf("New Switch: %#v", reading.Switch)
 		case reading.Portal != nil:
 			log.Printf("Portal Update: %#v", reading.Portal)
+		case reading.Thermometer != nil:
+			log.Printf("Thermometer Update (%s): %#v", reading.Device.Name, reading.Thermometer)
+		case reading.Motion != nil:
+			log.Printf("Motion Update (%s): %s", reading.Device.Name, time.Unix(reading.Motion.Motion, 0).Format("Jan 2 15:04:05"))
 		default:
 			log.Printf("Unknown message: %#v", reading)
 			continue
@@ -93,11 +120,11 @@ func readNetwork(udpConn *net.UDPConn, tstream chan rnet.Msg) {
 	}
 }
 
-var pingmsg = ngservice.WriteMessage(rnet.Context, &rnet.Ping{Respond: true})
+var pingmsg = &rnet.Ping{Respond: true}
 
 func ping(udpConn *net.UDPConn) {
 	// Ping network to find stuff.
-	n, err := udpConn.WriteToUDP(pingmsg, rnet.RefugeDiscovery)
+	n, err := rnet.WriteTo(udpConn, pingmsg, rnet.RefugeDiscovery)
 	if n == 0 || err != nil {
 		log.Printf("[Error] Failed to write to UDP! Bytes: %d, Err: %s", n, err)
 	}
@@ -109,13 +136,19 @@ type deviceState struct {
 	lastUpdate time.Time
 	lastOpened time.Time
 	lastEmail  time.Time
+	fault      refuge.Fault // Thermostat fault we last alerted on.
+}
+
+// portalOpen returns true if the portal is not secured (anything that isn't closed).
+func portalOpen(ps refuge.PortalState) bool {
+	return ps != refuge.PortalStateClosed && ps != refuge.PortalStateUnknown
 }
 
 const openAlertTime = time.Minute * 30
 const upAlertTime = time.Minute * 15
 
-func portalAlert(c Config, deviceUpdates chan refuge.Device, udpConn *net.UDPConn) {
-	// Portal watcher
+func portalAlert(c Config, deviceUpdates chan refuge.Device, removals chan string, udpConn *net.UDPConn) {
+	// Portal and thermostat fault watcher
 	devices := map[string]*deviceState{}
 	for {
 		select {
@@ -123,27 +156,45 @@ func portalAlert(c Config, deviceUpdates chan refuge.Device, udpConn *net.UDPCon
 			if !ok {
 				return
 			}
-			existing, ok := devices[up.Name]
+			existing, ok := devices[up.ID]
 			if !ok {
 				existing = &deviceState{Device: up}
-				devices[up.Name] = existing
+				devices[up.ID] = existing
+			}
+			if ts := up.Thermostat; ts != nil && ts.Fault != existing.fault {
+				if ts.Fault != refuge.FaultNone {
+					// The thermostat is protecting the house on its own, someone should check on it.
+					log.Printf("Thermostat %s is in its failsafe: %s.", up.Name, ts.Fault)
+					sendMail(c.Mailgun, "Refuge Alert", fmt.Sprintf("Thermostat %s is in its failsafe: %s (last temp %.1fC).", up.Name, ts.Fault, ts.Temp))
+				} else {
+					log.Printf("Thermostat %s recovered from its failsafe.", up.Name)
+				}
+				existing.fault = ts.Fault
 			}
 			if port := existing.Portal; port != nil {
-				if port.State != refuge.PortalStateOpen && up.Portal.State == refuge.PortalStateOpen {
+				if !portalOpen(port.State) && portalOpen(up.Portal.State) {
 					// If just opened, set the time.
 					log.Printf("Portal %s is open... starting timer for alert.", up.Name)
 					existing.lastOpened = time.Now()
-				} else if up.Portal.State != refuge.PortalStateOpen {
+				} else if !portalOpen(up.Portal.State) {
 					// if not open now, keep updating.
 					existing.lastOpened = time.Now()
 				}
+				if port.State != refuge.PortalStateObstructed && up.Portal.State == refuge.PortalStateObstructed {
+					// Device couldn't finish the move we asked for, let someone know right away.
+					log.Printf("Portal %s failed to open/close.", up.Name)
+					sendMail(c.Mailgun, "Refuge Alert", "Portal "+up.Name+" failed to finish opening/closing and may be obstructed.")
+				}
 				existing.Portal = up.Portal
+				existing.Name = up.Name // in case the device was renamed
 				existing.Addr = up.Addr // in case the address changed, update it
 			} else {
 				existing.Device = up
 			}
 			log.Printf("Got update (%s)", up.Name)
 			existing.lastUpdate = time.Now()
+		case id := <-removals:
+			delete(devices, id) // Removed devices don't need alerts anymore.
 		case <-time.After(time.Minute * 5):
 			break
 		}
@@ -160,7 +211,7 @@ func portalAlert(c Config, deviceUpdates chan refuge.Device, udpConn *net.UDPCon
 						log.Printf("Failed to resolve address of device: %s", err.Error())
 					}
 					log.Printf("Writing ping to device: %s at %s", p.Name, p.Device.Addr)
-					udpConn.WriteToUDP(pingmsg, addr)
+					rnet.WriteTo(udpConn, pingmsg, addr)
 					p.lastPing = time.Now()
 				}
 
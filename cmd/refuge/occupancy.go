@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// occupancyInterval is how often occupancy is resent to thermostats even if it hasn't changed,
+// so they can tell the server is still around.
+const occupancyInterval = time.Minute
+
+// OccupancyUpdate is a message to the client with the last motion seen in each room and the whole house.
+type OccupancyUpdate struct {
+	Occupancy Occupancy
+}
+
+// Occupancy is the last motion (unix seconds) seen by the motion sensors of each room and of the whole house.
+// Sensors that haven't been placed in a room only count towards the house.
+type Occupancy struct {
+	House int64
+	Rooms map[string]int64
+}
+
+// occupancyTracker remembers the last occupancy sent so only changes are pushed.
+type occupancyTracker struct {
+	lock sync.Mutex
+	last Occupancy
+}
+
+// occupancy gathers the last motion of every motion sensor by room.
+// Sensors that are still seeing motion count as motion now.
+func (srv *server) occupancy(now time.Time) Occupancy {
+	occ := Occupancy{Rooms: map[string]int64{}}
+	srv.datalock.RLock()
+	for _, dev := range srv.Devices {
+		if dev.device.Motion == nil {
+			continue
+		}
+		motion := dev.device.Motion.Motion
+		if dev.device.Motion.Active && dev.online {
+			motion = now.Unix()
+		}
+		if motion > occ.House {
+			occ.House = motion
+		}
+		if room := dev.pos.RoomID; room != "" && motion > occ.Rooms[room] {
+			occ.Rooms[room] = motion
+		}
+	}
+	srv.datalock.RUnlock()
+	return occ
+}
+
+// sendOccupancy sends the occupancy to the thermostats that use it and to all clients.
+// Unless forced it is only sent when it changed.
+func (srv *server) sendOccupancy(force bool) {
+	occ := srv.occupancy(time.Now())
+	ot := srv.occupancyState
+	ot.lock.Lock()
+	changed := !occ.equal(ot.last)
+	ot.last = occ
+	ot.lock.Unlock()
+	if !changed && !force {
+		return
+	}
+
+	type target struct {
+		addr   *net.UDPAddr
+		motion int64
+	}
+	targets := []target{}
+	srv.datalock.RLock()
+	for _, dev := range srv.Devices {
+		ts := dev.device.Thermostat
+		if ts == nil || ts.Occupancy == refuge.OccupancyLocal || dev.addr == nil {
+			continue
+		}
+		// Thermostats not placed in a room, or in a room without motion sensors, go by the whole house.
+		motion := occ.House
+		if m, ok := occ.Rooms[dev.pos.RoomID]; ts.Occupancy == refuge.OccupancyRoom && ok {
+			motion = m
+		}
+		if motion == 0 {
+			continue // No motion sensors at all, the thermostat falls back to its own.
+		}
+		targets = append(targets, target{addr: dev.addr, motion: motion})
+	}
+	srv.datalock.RUnlock()
+
+	if srv.conn != nil {
+		for _, t := range targets {
+			rnet.WriteTo(srv.conn, &refuge.Occupancy{Motion: t.motion}, t.addr)
+		}
+	}
+	if changed {
+		log.Printf("Occupancy changed, last motion in house at %s.", time.Unix(occ.House, 0).Format("Jan 2 15:04:05"))
+		srv.pushToClients(&OccupancyUpdate{Occupancy: occ})
+	}
+}
+
+// lastOccupancy returns the occupancy last sent to clients.
+func (srv *server) lastOccupancy() Occupancy {
+	srv.occupancyState.lock.Lock()
+	defer srv.occupancyState.lock.Unlock()
+	return srv.occupancyState.last
+}
+
+// occupancyMonitor resends occupancy to thermostats every occupancyInterval.
+func (srv *server) occupancyMonitor() {
+	for {
+		time.Sleep(occupancyInterval)
+		srv.sendOccupancy(true)
+	}
+}
+
+func (o Occupancy) equal(other Occupancy) bool {
+	if o.House != other.House || len(o.Rooms) != len(other.Rooms) {
+		return false
+	}
+	for room, motion := range o.Rooms {
+		if other.Rooms[room] != motion {
+			return false
+		}
+	}
+	return true
+}
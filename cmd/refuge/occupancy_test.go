@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+func TestOccupancy(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+	motion := func(room string, last int64, active, online bool) *refugeDevice {
+		return &refugeDevice{
+			device: refuge.Device{Motion: &refuge.Motion{Motion: last, Active: active}},
+			pos:    Position{RoomID: room},
+			online: online,
+		}
+	}
+	srv := &server{datalock: &sync.RWMutex{}, Devices: map[string]*refugeDevice{
+		"kitchen":  motion("kitchen", ago(time.Hour), false, true),
+		"office":   motion("office", ago(2*time.Hour), true, true), // Someone has been sitting there for 2 hours.
+		"bedroom":  motion("bedroom", ago(3*time.Hour), true, false),
+		"hall":     motion("", ago(30*time.Minute), false, true),
+		"thermo":   {device: refuge.Device{Thermostat: &refuge.Thermostat{}}, pos: Position{RoomID: "kitchen"}, online: true},
+		"unplaced": motion("", ago(4*time.Hour), false, true),
+	}}
+
+	got := srv.occupancy(now)
+	want := Occupancy{
+		House: now.Unix(),
+		Rooms: map[string]int64{
+			"kitchen": ago(time.Hour),
+			"office":  now.Unix(),
+			"bedroom": ago(3 * time.Hour), // Went offline while seeing motion, that doesn't last forever.
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
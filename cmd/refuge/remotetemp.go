@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// sendRemoteTemps sends thermostats the current reading of each of their temp sources.
+// Sources without any thermometer online are skipped, the thermostat notices they went stale.
+func (srv *server) sendRemoteTemps() {
+	type target struct {
+		addr *net.UDPAddr
+		msg  refuge.RemoteTemp
+	}
+	targets := []target{}
+	now := time.Now()
+	srv.datalock.RLock()
+	for id, dev := range srv.Devices {
+		if dev.device.Thermostat == nil || dev.addr == nil {
+			continue
+		}
+		for _, src := range dev.device.Thermostat.Sources {
+			if rt, ok := srv.sourceReading(src, id, now); ok {
+				targets = append(targets, target{addr: dev.addr, msg: rt})
+			}
+		}
+	}
+	srv.datalock.RUnlock()
+
+	if srv.conn == nil {
+		return
+	}
+	for _, t := range targets {
+		rnet.WriteTo(srv.conn, &t.msg, t.addr)
+	}
+}
+
+// sourceReading averages the thermometers of the source, leaving out the thermostat asking for it.
+// The age is of the least recently changed thermometer reading. datalock must be held.
+func (srv *server) sourceReading(src refuge.TempSource, thermostat string, now time.Time) (refuge.RemoteTemp, bool) {
+	rt := refuge.RemoteTemp{Source: src}
+	count := 0
+	for id, dev := range srv.Devices {
+		if id == thermostat || dev.device.Thermometer == nil || !dev.online {
+			continue
+		}
+		if !sourceMatches(src, id, dev.pos.RoomID) {
+			continue
+		}
+		rt.Temp += dev.device.Thermometer.Temp
+		rt.Humidity += dev.device.Thermometer.Humidity
+		if age := uint32(now.Sub(dev.tempAt).Seconds()); age > rt.Age {
+			rt.Age = age
+		}
+		count++
+	}
+	if count == 0 {
+		return rt, false
+	}
+	rt.Temp /= float32(count)
+	rt.Humidity /= float32(count)
+	return rt, true
+}
+
+// sourceMatches returns true if the device with the given ID and room is a thermometer of the source.
+func sourceMatches(src refuge.TempSource, id, room string) bool {
+	if src.ID != "" {
+		return src.ID == id
+	}
+	return src.Room != "" && src.Room == room
+}
+
+// remoteTempMonitor resends remote temps every occupancyInterval, so thermostats keep fresh readings
+// from thermometers that haven't changed.
+func (srv *server) remoteTempMonitor() {
+	for {
+		time.Sleep(occupancyInterval)
+		srv.sendRemoteTemps()
+	}
+}
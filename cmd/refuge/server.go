@@ -37,51 +37,80 @@ type server struct {
 	Devices      map[string]*refugeDevice
 	deviceStream chan rnet.Msg
 	devUpdates   chan refuge.Device
+	devRemovals  chan string
 
 	clientslock   *sync.Mutex
 	clientStreams []*websocket.Conn
 
-	conn      *net.UDPConn
-	eventData []refuge.TempEvent
-	statsDir  string
+	conn           *net.UDPConn
+	commands       *commander
+	occupancyState *occupancyTracker
+	eventData      []refuge.TempEvent
+	statsDir       string
 
-	done chan struct{}
+	done      chan struct{}
+	quit      chan struct{}  // Closed by stop to end the goroutines sending on devUpdates.
+	listeners sync.WaitGroup // Heartbeat listener, devUpdates is closed once it is done.
 }
 
-func runServer(deviceStream chan rnet.Msg, udpConn *net.UDPConn) *server {
+func runServer(ns netStreams) *server {
+	deviceStream, udpConn := ns.devices, ns.conn
 	srv := &server{
-		datalock:     &sync.RWMutex{},
-		Devices:      map[string]*refugeDevice{},
-		deviceStream: deviceStream,
-		clientslock:  &sync.Mutex{},
-		done:         make(chan struct{}, 1),
-		devUpdates:   make(chan refuge.Device, 5), // Updates from network -> portal watcher
-		conn:         udpConn,
-		statsDir:     globalConfig.StatsDir,
+		datalock:       &sync.RWMutex{},
+		Devices:        map[string]*refugeDevice{},
+		deviceStream:   deviceStream,
+		clientslock:    &sync.Mutex{},
+		done:           make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+		devUpdates:     make(chan refuge.Device, 5), // Updates from network -> portal watcher
+		devRemovals:    make(chan string, 5),        // Removed devices -> portal watcher
+		conn:           udpConn,
+		commands:       newCommander(udpConn),
+		occupancyState: &occupancyTracker{},
+		statsDir:       globalConfig.StatsDir,
 	}
-	go portalAlert(globalConfig, srv.devUpdates, udpConn)
+	go portalAlert(globalConfig, srv.devUpdates, srv.devRemovals, udpConn)
+	go srv.livenessMonitor(globalConfig.Liveness)
+	srv.listeners.Add(1)
+	go srv.heartbeatListener(ns.heartbeats)
+	go srv.retryCommands()
+	go srv.occupancyMonitor()
+	go srv.remoteTempMonitor()
+	go func() {
+		for ack := range ns.acks {
+			srv.commands.ack(ack.ReqID)
+		}
+	}()
 	// Updater goroutine. Updates data state and pushes the new state to websocket clients
 	go eventListener(srv, deviceStream)
 	return srv
 }
 
-// Getter functions convert names to device keys (avoiding spaces)
+// deviceKey returns the key a device is stored under.
+// Devices send a persistent unique ID, older devices without one fall back to the name (avoiding spaces).
+func deviceKey(d *refuge.Device) string {
+	if d.ID != "" {
+		return d.ID
+	}
+	return strings.Replace(d.Name, " ", "", -1)
+}
 
-func (srv *server) getDevice(name string) (device *refugeDevice) {
-	name = strings.Replace(name, " ", "", -1)
-	if name == "" {
-		log.Printf("[Error] Attempted to fetch an empty name string!")
+func (srv *server) getDevice(id string) (device *refugeDevice) {
+	if id == "" {
+		log.Printf("[Error] Attempted to fetch an empty device id!")
 		return nil
 	}
 	srv.datalock.Lock()
-	device = srv.Devices[name]
+	device = srv.Devices[id]
 	srv.datalock.Unlock()
 	return device
 }
 func (srv *server) stop() {
+	close(srv.quit)
+	srv.listeners.Wait()
 	close(srv.deviceStream) // close the stats file we have been writing.
-	close(srv.devUpdates)
 	<-srv.done
+	close(srv.devUpdates) // nothing sends on it anymore.
 }
 
 type refugeDevice struct {
@@ -89,6 +118,32 @@ type refugeDevice struct {
 	// conn   *net.UDPConn
 	addr *net.UDPAddr
 	pos  Position
+
+	lastSeen time.Time // last time we heard anything from the device
+	tempAt   time.Time // last time the thermometer reading changed, heartbeats don't make a reading fresh
+	online   bool      // false once the device has been quiet for too long
+	uptime   int64     // seconds the device has been running, from the last heartbeat
+	hbSeq    uint64    // sequence number of the last heartbeat
+}
+
+// sameReading returns true if both thermometers have the same raw and calibrated readings.
+func sameReading(a, b *refuge.Thermometer) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Temp == b.Temp && a.Humidity == b.Humidity && a.RawTemp == b.RawTemp && a.RawHumidity == b.RawHumidity
+}
+
+// update returns the client message for the current state of the device.
+func (rd *refugeDevice) update() *DeviceUpdate {
+	d := rd.device
+	return &DeviceUpdate{
+		Device:   &d,
+		Pos:      rd.pos,
+		LastSeen: rd.lastSeen,
+		Online:   rd.online,
+		Uptime:   rd.uptime,
+	}
 }
 
 // serve creates the state object "server" and http handlers and launches the http listener.
@@ -183,12 +238,24 @@ func eventListener(srv *server, deviceStream chan rnet.Msg) {
 			return
 		}
 		td := msg.Device
-		existing := srv.getDevice(td.Name)
+		id := deviceKey(td)
+		td.ID = id
+		existing := srv.getDevice(id)
 		newd := &refugeDevice{
-			device: *td,
+			device:   *td,
+			lastSeen: time.Now(),
+			online:   true,
+		}
+		if td.Thermometer != nil {
+			newd.tempAt = newd.lastSeen
 		}
 		if existing != nil {
 			newd.pos = existing.pos
+			newd.uptime = existing.uptime
+			newd.hbSeq = existing.hbSeq
+			if sameReading(existing.device.Thermometer, td.Thermometer) {
+				newd.tempAt = existing.tempAt
+			}
 			if existing.device.Addr != td.Addr {
 				raddr, err := net.ResolveUDPAddr("udp", td.Addr)
 				if err != nil {
@@ -202,20 +269,14 @@ func eventListener(srv *server, deviceStream chan rnet.Msg) {
 		} else {
 			raddr, err := net.ResolveUDPAddr("udp", td.Addr)
 			if err != nil {
-				log.Printf("Failed to resolve UDP addr for device (%#v): %s", existing.device, err)
+				log.Printf("Failed to resolve UDP addr for device (%#v): %s", *td, err)
 				continue
 			}
 			newd.addr = raddr
 
-			fdata, err := ioutil.ReadFile("./pos/" + td.Name + ".pos")
-			if err == nil {
-				pos := &Position{}
-				json.Unmarshal(fdata, pos)
-				newd.pos = *pos
-			}
+			newd.pos = loadPosition(id, td.Name)
 		}
 
-		id := strings.Replace(td.Name, " ", "", -1)
 		if newd.device.Thermostat != nil {
 			dowrite := true
 			if dev, ok := srv.Devices[id]; ok {
@@ -237,7 +298,8 @@ func eventListener(srv *server, deviceStream chan rnet.Msg) {
 
 			if dowrite {
 				te := refuge.TempEvent{
-					Name:     id,
+					ID:       id,
+					Name:     td.Name,
 					Time:     time.Now(),
 					Temp:     newd.device.Thermometer.Temp,
 					Humidity: newd.device.Thermometer.Humidity,
@@ -256,32 +318,44 @@ func eventListener(srv *server, deviceStream chan rnet.Msg) {
 		srv.datalock.Unlock()
 		srv.devUpdates <- *td // push updates to alert system
 
-		up := &DeviceUpdate{
-			Device: &newd.device,
-			Pos:    newd.pos,
+		// Now push the update to all connected websockets
+		srv.pushToClients(newd.update())
+
+		// New thermostats get occupancy right away instead of waiting for the next resend.
+		newThermostat := existing == nil && td.Thermostat != nil
+		if td.Motion != nil || newThermostat {
+			srv.sendOccupancy(newThermostat)
 		}
-		// Serialize for clients
-		d, err := json.Marshal(up)
-		if err != nil {
-			log.Printf("[Error] Failed to marshal thermal data to json: %s", err)
+		if td.Thermometer != nil {
+			srv.sendRemoteTemps()
 		}
+	}
+}
 
-		// Now push the update to all connected websockets
-		deadstreams := []int{}
-		srv.clientslock.Lock()
-		for i, cs := range srv.clientStreams {
-			err := cs.WriteMessage(websocket.TextMessage, d)
-			if err != nil {
-				deadstreams = append(deadstreams, i)
-			}
-		}
-		// remove dead streams now
-		for i := len(deadstreams) - 1; i > -1; i-- {
-			idx := deadstreams[i]
-			srv.clientStreams = append(srv.clientStreams[:idx], srv.clientStreams[idx+1:]...)
+// pushToClients serializes the given message and writes it to all connected websockets.
+// Any websockets that fail to write are removed.
+func (srv *server) pushToClients(v interface{}) {
+	// Serialize for clients
+	d, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[Error] Failed to marshal client message to json: %s", err)
+		return
+	}
+
+	deadstreams := []int{}
+	srv.clientslock.Lock()
+	for i, cs := range srv.clientStreams {
+		err := cs.WriteMessage(websocket.TextMessage, d)
+		if err != nil {
+			deadstreams = append(deadstreams, i)
 		}
-		srv.clientslock.Unlock()
 	}
+	// remove dead streams now
+	for i := len(deadstreams) - 1; i > -1; i-- {
+		idx := deadstreams[i]
+		srv.clientStreams = append(srv.clientStreams[:idx], srv.clientStreams[idx+1:]...)
+	}
+	srv.clientslock.Unlock()
 }
 
 func getTodayDate() time.Time {
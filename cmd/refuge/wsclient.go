@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"gitlab.com/lologarithm/refuge/refuge"
@@ -14,17 +15,36 @@ var upgrader = websocket.Upgrader{} // use default options
 
 // Request is sent from websocket client to server to request change to someting
 type Request struct {
-	Name    string           // Name of device to update
-	Climate *refuge.Settings // Climate Control Change Request
-	Toggle  int              // Toggle of device request.
-	Pos     *Position        // Request to change device position
+	ID          string              // ID of device to update
+	Climate     *refuge.Settings    // Climate Control Change Request
+	Schedule    *refuge.Schedule    // Thermostat schedule to replace the current one with
+	Setback     *refuge.Setback     // Thermostat away setback policy change
+	Calibration *refuge.Calibration // Thermometer calibration change
+	Toggle      int                 // Toggle of device request.
+	Lock        int                 // Lock/Unlock of portal request, see refuge.LockState
+	Pos         *Position           // Request to change device position
+	Remove      bool                // Request to remove device from the list
 }
 
 // DeviceUpdate is a message to the client containing updated information about
 // a particular device
 type DeviceUpdate struct {
 	*refuge.Device
-	Pos Position
+	Pos      Position
+	LastSeen time.Time // Last time the server heard from the device
+	Online   bool      // False if the device hasn't been heard from in a while
+	Uptime   int64     // Seconds the device has been running, 0 if it doesn't send heartbeats
+}
+
+// CommandFailed is a message to the client that a change it requested was never acknowledged by the device.
+type CommandFailed struct {
+	Failed string // ID of the device the request was for
+	Error  string
+}
+
+// DeviceRemoved is a message to the client that a device was removed from the list.
+type DeviceRemoved struct {
+	Removed string // ID of removed device
 }
 
 // Position of a device in the UI
@@ -33,6 +53,23 @@ type Position struct {
 	RoomID string
 }
 
+// loadPosition reads the saved UI position of the device.
+// Positions used to be saved by device name, so if there is no position saved for the ID
+// yet the old name based file is used (and saved by ID from now on).
+func loadPosition(id, name string) Position {
+	pos := Position{}
+	fdata, err := ioutil.ReadFile("./pos/" + id + ".pos")
+	if err != nil {
+		fdata, err = ioutil.ReadFile("./pos/" + name + ".pos")
+		if err != nil {
+			return pos
+		}
+		ioutil.WriteFile("./pos/"+id+".pos", fdata, 0644)
+	}
+	json.Unmarshal(fdata, &pos)
+	return pos
+}
+
 func (srv *server) clientStreamHandler(w http.ResponseWriter, r *http.Request) {
 	access := auth(w, r)
 	if access == AccessNone {
@@ -42,13 +79,13 @@ func (srv *server) clientStreamHandler(w http.ResponseWriter, r *http.Request) {
 	msgs := make([]*DeviceUpdate, 0, 10) // 10 seems like a reasonable number of devides.
 	srv.datalock.Lock()
 	for _, v := range srv.Devices {
-		d := v.device
-		msgs = append(msgs, &DeviceUpdate{Device: &d, Pos: v.pos})
+		msgs = append(msgs, v.update())
 	}
 	srv.datalock.Unlock()
 	for _, msg := range msgs {
 		c.WriteJSON(msg)
 	}
+	c.WriteJSON(&OccupancyUpdate{Occupancy: srv.lastOccupancy()})
 	srv.clientslock.Lock()
 	srv.clientStreams = append(srv.clientStreams, c)
 	srv.clientslock.Unlock()
@@ -76,19 +113,36 @@ func clientStream(w http.ResponseWriter, r *http.Request, access int, srv *serve
 			if access != AccessWrite {
 				continue
 			}
-			dev := srv.getDevice(v.Name)
-			if v.Pos != nil {
+			dev := srv.getDevice(v.ID)
+			if dev == nil {
+				continue // Unknown device, nothing to change
+			}
+			if v.Remove {
+				srv.removeDevice(v.ID)
+			} else if v.Pos != nil {
 				d, _ := json.Marshal(v.Pos)
-				ioutil.WriteFile("./pos/"+dev.device.Name+".pos", d, 0644)
+				ioutil.WriteFile("./pos/"+v.ID+".pos", d, 0644)
 				dev.pos = *v.Pos
 			} else if v.Climate != nil {
-				setTherm(*v.Climate, srv.conn, dev.addr)
+				setTherm(srv, c, dev, *v.Climate)
+			} else if v.Schedule != nil {
+				setSchedule(srv, c, dev, *v.Schedule)
+			} else if v.Setback != nil {
+				setSetback(srv, c, dev, *v.Setback)
+			} else if v.Calibration != nil {
+				if dev.device.Thermometer != nil {
+					setCalibration(srv, c, dev, *v.Calibration)
+				}
 			} else if v.Toggle > 0 {
 				if dev.device.Switch != nil {
-					toggleSwitch(v.Toggle, srv.conn, dev.addr)
+					toggleSwitch(srv, c, dev, v.Toggle)
+				}
+				if dev.device.Portal != nil {
+					togglePortal(srv, c, dev, v.Toggle)
 				}
+			} else if v.Lock > 0 {
 				if dev.device.Portal != nil {
-					togglePortal(v.Toggle, srv.conn, dev.addr)
+					lockPortal(srv, c, dev, v.Lock)
 				}
 			}
 		}
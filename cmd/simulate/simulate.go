@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+func main() {
+	low := flag.Float64("low", 19, "low temp setting (C)")
+	high := flag.Float64("high", 25, "high temp setting (C)")
+	indoor := flag.Float64("indoor", 21, "indoor temp (C) at the start")
+	outLow := flag.Float64("outlow", -5, "lowest outdoor temp (C) of the day, at 5am")
+	outHigh := flag.Float64("outhigh", 8, "highest outdoor temp (C) of the day, at 5pm")
+	hours := flag.Int("hours", 24, "hours to simulate, starting at midnight")
+	step := flag.Duration("step", time.Minute, "how often Control gets a reading")
+	tolerance := flag.Float64("tolerance", 1, "how far (C) outside the settings counts as a comfort violation")
+	stages := flag.Int("stages", 1, "stages of heating/cooling")
+	heatKW := flag.Float64("heatkw", 10, "heat added by each heating stage (kW)")
+	coolKW := flag.Float64("coolkw", 5, "heat removed by each cooling stage (kW)")
+	auxKW := flag.Float64("auxkw", 0, "heat added by aux heat (kW), 0 if there is none")
+	mass := flag.Float64("mass", 10000, "thermal mass of the house (kJ per C)")
+	loss := flag.Float64("loss", 0.25, "heat lost through the walls (kW per C between indoors and outdoors)")
+	minRun := flag.Duration("minrun", climate.DefaultOptions.MinRun, "minimum time heating/cooling runs once started")
+	minOff := flag.Duration("minoff", climate.DefaultOptions.MinOff, "minimum time heating/cooling stays off once stopped")
+	hysteresis := flag.Float64("hysteresis", float64(climate.DefaultOptions.Hysteresis), "how far (C) past the low/high setting before heating/cooling starts")
+	overshoot := flag.Float64("overshoot", float64(climate.DefaultOptions.Overshoot), "how far (C) past the low/high setting to keep heating/cooling before stopping")
+	csvPath := flag.String("csv", "", "file to write the temp curve of every step to")
+	replay := flag.String("replay", "", "sensor recording (from thermo -record) to run Control on instead of the simulated house")
+	speed := flag.Float64("speed", 0, "replay this many times faster than it was recorded, 0 for as fast as possible")
+	away := flag.Uint("away", uint(climate.DefaultSetback.AwayMinutes), "minutes without motion before setting back the temps when replaying, 0 to never set back")
+	verbose := flag.Bool("v", false, "show the control loop output")
+	flag.Parse()
+
+	opts := climate.DefaultOptions
+	opts.MinRun, opts.MinOff = *minRun, *minOff
+	opts.Hysteresis, opts.Overshoot = float32(*hysteresis), float32(*overshoot)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	house := climate.NewHouse(float32(*indoor), climate.DailyOutdoor(float32(*outLow), float32(*outHigh)), start)
+	house.Mass, house.Loss = float32(*mass), float32(*loss)
+	house.HeatStage, house.CoolStage, house.AuxHeat = float32(*heatKW), float32(*coolKW), float32(*auxKW)
+	house.NumStages = *stages
+
+	settings := refuge.Settings{Low: float32(*low), High: float32(*high), Mode: refuge.ModeAuto}
+	var records []sensor.Record
+	if *replay != "" {
+		var err error
+		if records, err = sensor.LoadRecording(*replay); err != nil {
+			fmt.Printf("Failed to load recording: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	var res climate.SimResult
+	if records != nil {
+		setback := climate.DefaultSetback
+		setback.Enabled, setback.AwayMinutes = *away > 0, uint16(*away)
+		g := climate.NewGuard(&climate.FakeController{}, opts)
+		g.Quiet = !*verbose
+		res = climate.Replay(g, records, settings, setback, *speed, float32(*tolerance))
+	} else {
+		g := climate.NewGuard(house, opts)
+		g.Quiet = !*verbose // Control logs every step, only show the report.
+		res = climate.Simulate(g, house, settings, refuge.Setback{}, time.Duration(*hours)*time.Hour, *step, float32(*tolerance))
+	}
+
+	if *csvPath != "" {
+		if err := writeCSV(*csvPath, res.Samples); err != nil {
+			fmt.Printf("Failed to write csv: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if records != nil {
+		reportReplay(res)
+		return
+	}
+	report(res)
+}
+
+// report prints the temp curve once an hour and the totals.
+func report(res climate.SimResult) {
+	fmt.Printf("%-6s %8s %8s  %s\n", "Time", "Outdoor", "Indoor", "State")
+	for _, s := range res.Samples {
+		if s.Time.Minute() != 0 || s.Time.Second() != 0 {
+			continue
+		}
+		fmt.Printf("%-6s %7.1fC %7.1fC  %s\n", s.Time.Format("15:04"), s.Outdoor, s.Indoor, stateName(s.State, s.Stage))
+	}
+	fmt.Printf("\nCycles: %d\nRuntime: %s\nComfort violations: %s (worst %.1fC outside the settings)\n", res.Cycles, res.Runtime, res.Violation, res.Worst)
+}
+
+// reportReplay prints the temp every time the state changed and the totals.
+func reportReplay(res climate.SimResult) {
+	fmt.Printf("%-15s %8s  %s\n", "Time", "Indoor", "State")
+	for i, s := range res.Samples {
+		if i > 0 && i < len(res.Samples)-1 && s.State == res.Samples[i-1].State && s.Stage == res.Samples[i-1].Stage {
+			continue
+		}
+		fmt.Printf("%-15s %7.1fC  %s\n", s.Time.Format("Jan 2 15:04:05"), s.Indoor, stateName(s.State, s.Stage))
+	}
+	fmt.Printf("\nCycles: %d\nRuntime: %s\nComfort violations: %s (worst %.1fC outside the settings)\n", res.Cycles, res.Runtime, res.Violation, res.Worst)
+}
+
+func stateName(state refuge.ControlState, stage int) string {
+	switch state {
+	case refuge.StateHeating:
+		return fmt.Sprintf("heating (stage %d)", stage)
+	case refuge.StateCooling:
+		return fmt.Sprintf("cooling (stage %d)", stage)
+	case refuge.StateFanning:
+		return "fan"
+	}
+	return "idle"
+}
+
+func writeCSV(path string, samples []climate.SimSample) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(f, "time,outdoor,indoor,state,stage")
+	for _, s := range samples {
+		fmt.Fprintf(f, "%s,%.2f,%.2f,%d,%d\n", s.Time.Format("15:04:05"), s.Outdoor, s.Indoor, s.State, s.Stage)
+	}
+	return f.Close()
+}
@@ -7,49 +7,42 @@ import (
 	"os"
 	"time"
 
-	rpio "github.com/stianeikeland/go-rpio"
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
 )
 
 func main() {
 	cpin := flag.Int("cpin", 4, "input pin to control")
 	name := flag.String("name", "", "name of device to switch")
+	keyfile := flag.String("keyfile", "", "file holding the shared household key used to sign messages")
+	encrypt := flag.Bool("encrypt", false, "encrypt all messages with the household key and drop any that aren't encrypted")
+	backend := flag.String("gpio", "auto", "gpio backend: auto, rpio, chip, /dev/gpiochipN or fake")
+	heartbeat := flag.Duration("heartbeat", time.Minute, "how often to send a heartbeat to listeners, 0 to disable")
 	flag.Parse()
+	rnet.LoadKey(*keyfile)
+	rnet.RequireEncryption(*encrypt)
 
 	fmt.Printf("Name: %s, Control Pin: %d\n", *name, *cpin)
 	if *name == "" {
 		fmt.Printf("Name parameter is required.")
 		os.Exit(1)
 	}
-	run(*name, *cpin)
+	run(*name, *cpin, *backend, *heartbeat)
 }
 
-func run(name string, cpin int) {
+func run(name string, cpin int, backend string, heartbeat time.Duration) {
 	// Listen to network
-	poll := setupNetwork(name)
+	node := rnet.NewNode(&refuge.Device{Name: name}, heartbeat)
 
-	err := rpio.Open()
-	if err != nil {
-		log.Printf("Unable to use real pins...")
-		for {
-			v := poll()
-			if v > 0 {
-				log.Printf("Setting fake switch to: %v", v)
-			}
-			time.Sleep(time.Millisecond * 100)
-		}
-	}
-	// Set switch to off
-	control := rpio.Pin(cpin)
-	control.Mode(rpio.Output)
-	control.High()
+	// Now just hang out until CTRL+C
+	ctx := device.UntilInterrupt()
 
-	for {
-		v := poll()
-		if v == 1 {
-			control.Low()
-		} else if v == 2 {
-			control.High()
-		}
-		time.Sleep(time.Millisecond * 200)
+	board := gpio.OpenOrFake(backend)
+	defer board.Close()
+	if fake, ok := board.(*gpio.Fake); ok {
+		fake.FakePin(cpin).OnWrite = func(high bool) { log.Printf("Setting fake switch to: %v", high) }
 	}
+	device.Run(ctx, node, time.Millisecond*200, device.NewSwitch(board.Pin(cpin)))
 }
@@ -4,63 +4,183 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
+	"time"
 
-	rpio "github.com/stianeikeland/go-rpio"
 	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/device"
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/rnet"
 	"gitlab.com/lologarithm/refuge/sensor"
 )
 
 func main() {
-	tpin := flag.Int("tpin", 4, "input pin to read for temp")
+	tpin := flag.Int("tpin", 4, "input pin to read for temp from a DHT sensor")
+	sensorKind := flag.String("sensor", sensor.KindDHT22, "temp sensor: dht22, dht11 or am2302 (on tpin), ds18b20 (1-wire) or bme280 (i2c)")
+	w1id := flag.String("w1id", "", "ID (28-xxxxxxxxxxxx) of the ds18b20 to read, defaults to the first one found")
+	i2cBus := flag.String("i2cbus", sensor.DefaultI2CBus, "i2c bus device the bme280 is on")
+	i2cAddr := flag.Uint("i2caddr", sensor.DefaultBME280Addr, "i2c address of the bme280")
+	tempOffset := flag.Float64("tempoffset", 0, "added to the temp (C) after scaling, to calibrate the sensor")
+	tempScale := flag.Float64("tempscale", 1, "temp readings are multiplied by this, to calibrate the sensor")
+	humiOffset := flag.Float64("humioffset", 0, "added to the humidity (%) after scaling, to calibrate the sensor")
+	humiScale := flag.Float64("humiscale", 1, "humidity readings are multiplied by this, to calibrate the sensor")
+	filter := flag.String("filter", sensor.DefaultFilter.String(), "smoothing of the calibrated readings: none, median[:n], ema[:weight] or kalman[:processnoise[:measurementnoise]]")
 	mpin := flag.Int("mpin", 0, "input pin to read for motion")
+	debounce := flag.Duration("debounce", sensor.DefaultDebounce, "how long the motion pin has to hold a level before it counts")
+	motionHold := flag.Duration("motionhold", sensor.DefaultMotionHold, "motion ends once the motion pin has been low this long")
 	hpin := flag.Int("hpin", 24, "output pin to turn on heat")
 	cpin := flag.Int("cpin", 22, "output pin to turn on cooling")
 	fpin := flag.Int("fpin", 23, "output pin to turn on fan")
+	h2pin := flag.Int("h2pin", 0, "output pin to turn on the second heat stage, 0 if there is none")
+	c2pin := flag.Int("c2pin", 0, "output pin to turn on the second cooling/compressor stage, 0 if there is none")
+	auxpin := flag.Int("auxpin", 0, "output pin to turn on aux/emergency heat, 0 if there is none")
+	heatpump := flag.Bool("heatpump", false, "heat with the compressor (cpin/c2pin) and a reversing valve instead of hpin/h2pin")
+	vpin := flag.Int("vpin", 0, "output pin for the heat pump reversing valve (O/B)")
+	valveOnHeat := flag.Bool("valveonheat", false, "reversing valve is energized to heat (B) instead of to cool (O)")
+	activeHigh := flag.Bool("activehigh", false, "relays turn on when their pin is high instead of low")
+	stageDelta := flag.Float64("stagedelta", float64(climate.DefaultOptions.StageDelta), "add a heating/cooling stage for every this many C the temp is from the setting")
+	stageTime := flag.Duration("stagetime", climate.DefaultOptions.StageTime, "add a heating/cooling stage when the current one has run this long")
 	name := flag.String("name", "", "name of thermostat")
+	keyfile := flag.String("keyfile", "", "file holding the shared household key used to sign messages")
+	encrypt := flag.Bool("encrypt", false, "encrypt all messages with the household key and drop any that aren't encrypted")
+	minRun := flag.Duration("minrun", climate.DefaultOptions.MinRun, "minimum time heating/cooling runs once started")
+	minOff := flag.Duration("minoff", climate.DefaultOptions.MinOff, "minimum time heating/cooling stays off once stopped")
+	hysteresis := flag.Float64("hysteresis", float64(climate.DefaultOptions.Hysteresis), "how far (C) past the low/high setting before heating/cooling starts")
+	overshoot := flag.Float64("overshoot", float64(climate.DefaultOptions.Overshoot), "how far (C) past the low/high setting to keep heating/cooling before stopping")
+	freeze := flag.Float64("freeze", float64(climate.DefaultOptions.Freeze), "heat below this temp (C) no matter the settings")
+	overTemp := flag.Float64("overtemp", float64(climate.DefaultOptions.OverTemp), "never heat above this temp (C)")
+	sensorTimeout := flag.Duration("sensortimeout", climate.DefaultOptions.SensorTimeout, "turn everything off when there has been no good temp reading for this long, 0 to disable")
+	backend := flag.String("gpio", "auto", "gpio backend: auto, rpio, chip, /dev/gpiochipN or fake")
+	heartbeat := flag.Duration("heartbeat", time.Minute, "how often to send a heartbeat to listeners, 0 to disable")
+	occupancy := flag.String("occupancy", "local", "motion sensors the away setback goes by: local (mpin only), room or house (from the server)")
+	sources := flag.String("sources", "", "remote thermometers to control on instead of tpin: comma separated device IDs or 'room:<room id>', each optionally '=<weight>'")
+	stale := flag.Duration("stale", device.DefaultStale, "fall back to tpin once remote thermometer readings are this old")
+	record := flag.String("record", "", "file to append every temp reading and motion event to, for replaying with cmd/simulate")
+	stateFile := flag.String("state", "", "file to save settings and schedule to across restarts, defaults to '<binary>.state'")
 	flag.Parse()
+	rnet.LoadKey(*keyfile)
+	rnet.RequireEncryption(*encrypt)
 	fmt.Printf("Name: %s\n\tThermo Pin: %d\n\tHeating Pin: %d\n\tCooling Pin: %d\n\tFan Pin: %d\n", *name, *tpin, *hpin, *cpin, *fpin)
 	if *name == "" {
 		fmt.Printf("Name parameter is required.")
 		os.Exit(1)
 	}
 	// run the thermostat
-	run(*name, *tpin, *mpin, *fpin, *cpin, *hpin)
+	opts := climate.Options{
+		Hysteresis: float32(*hysteresis),
+		Overshoot:  float32(*overshoot),
+		MinRun:     *minRun,
+		MinOff:     *minOff,
+		StageDelta: float32(*stageDelta),
+		StageTime:  *stageTime,
 
-	rpio.Close()
+		Freeze:        float32(*freeze),
+		OverTemp:      float32(*overTemp),
+		SensorTimeout: *sensorTimeout,
+	}
+	eq := climate.Equipment{
+		ActiveHigh:  *activeHigh,
+		Fan:         *fpin,
+		Heat:        pins(*hpin, *h2pin),
+		Cool:        pins(*cpin, *c2pin),
+		Aux:         *auxpin,
+		HeatPump:    *heatpump,
+		Valve:       *vpin,
+		ValveOnHeat: *valveOnHeat,
+	}
+	occ, err := device.ParseOccupancy(*occupancy)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	srcs, err := device.ParseSources(*sources)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *stateFile == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Printf("Unable to find the binary path for the state file, use --state: %s\n", err)
+			os.Exit(1)
+		}
+		*stateFile = exe + ".state"
+	}
+	remote := remoteConfig{occupancy: occ, sources: srcs, stale: *stale}
+	fc, err := sensor.ParseFilter(*filter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	tc := thermConfig{
+		sensor: sensor.Config{Kind: *sensorKind, W1ID: *w1id, I2CBus: *i2cBus, I2CAddr: uint16(*i2cAddr)},
+		pin:    *tpin,
+		cal: sensor.Calibration{
+			TempOffset: float32(*tempOffset),
+			TempScale:  float32(*tempScale),
+			HumiOffset: float32(*humiOffset),
+			HumiScale:  float32(*humiScale),
+		},
+		filter:   fc,
+		interval: time.Minute * 2,
+	}
+	mc := motionConfig{pin: *mpin, debounce: *debounce, hold: *motionHold}
+	rc := recordConfig{record: *record}
+	run(*name, tc, mc, rc, eq, opts, remote, *backend, *heartbeat, *stateFile)
 }
 
 // run in short will take sensor readings, emit them on network, and forward them to the climate controller.
 // Additionally it will accept new settings from the network and send them into the climate controller.
-func run(name string, thermpin, motionpin, fanpin, coolpin, heatpin int) {
+func run(name string, tc thermConfig, mc motionConfig, rc recordConfig, eq climate.Equipment, opts climate.Options, remote remoteConfig, backend string, heartbeat time.Duration, stateFile string) {
 	// Now just hang out until CTRL+C
-	close := make(chan os.Signal, 1)
-	signal.Notify(close, os.Interrupt)
+	ctx := device.UntilInterrupt()
 
-	var cl climate.Controller
-	err := rpio.Open()
-	if err != nil {
-		cl = &climate.FakeController{}
-		fmt.Printf("Unable to open raspberry pi gpio pins: %s\n-----  Defaulting to use fake data.  -----\n", err)
-		getMot := func() bool { return true }
-		getTherm := func(includeWait bool) (float32, float32, bool) { return 20, 20, true }
-		go runThermostat(name, cl, close, getTherm, getMot)
-		return
+	board := gpio.OpenOrFake(backend)
+	defer board.Close()
+	if fake, ok := board.(*gpio.Fake); ok && sensor.IsDHT(tc.sensor.Kind) {
+		sensor.FakeDHT(fake.FakePin(tc.pin), sensor.DHTModelOf(tc.sensor.Kind))
 	}
 
-	cl = climate.NewController(heatpin, coolpin, fanpin)
-	var getMot func() bool
-	if motionpin != 0 {
-		mp := rpio.Pin(motionpin)
-		mp.PullDown()
-		mp.Mode(rpio.Input)
-		getMot = func() bool { return sensor.ReadMotion(mp) }
+	cl := climate.NewEquipmentController(board, eq)
+	var rec *sensor.Recorder
+	if rc.record != "" {
+		var err error
+		if rec, err = sensor.OpenRecorder(rc.record); err != nil {
+			fmt.Printf("Failed to open the recording: %s\n", err)
+			return
+		}
+		defer rec.Close()
+	}
+	var motion *device.Motion
+	if mc.pin != 0 {
+		var src sensor.MotionEvents = sensor.NewMotionSource(board.Pin(mc.pin), mc.debounce, mc.hold)
+		if rec != nil {
+			src = sensor.RecordMotion(src, rec)
+		}
+		motion = device.NewMotionFrom(src)
 	} else {
 		print("No motion sensor attached. Defaulting to always have motion 'on'.\n")
 	}
-	tp := rpio.Pin(thermpin)
-	// This closure just abstracts the need for knowing the pin to read. The controller logic only cares
-	// about returning the values without having to worry about how it got it.
-	getTherm := func(includeWait bool) (float32, float32, bool) { return sensor.ReadDHT22(tp, includeWait) }
-	runThermostat(name, cl, close, getTherm, getMot)
+	if sensor.IsDHT(tc.sensor.Kind) {
+		tc.sensor.Pin = board.Pin(tc.pin)
+	}
+	therm, err := sensor.Open(tc.sensor)
+	if err != nil {
+		fmt.Printf("Failed to open the temp sensor: %s\n", err)
+		return
+	}
+	if rec != nil {
+		therm = sensor.RecordThermometer(therm, rec)
+	}
+	runThermostat(ctx, name, heartbeat, stateFile, cl, opts, remote, tc, therm, motion)
+}
+
+// pins returns the connected (non 0) pins.
+func pins(all ...int) []int {
+	connected := []int{}
+	for _, p := range all {
+		if p != 0 {
+			connected = append(connected, p)
+		}
+	}
+	return connected
 }
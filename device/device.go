@@ -0,0 +1,58 @@
+// Package device holds the logic for each kind of device capability (switches, portals, thermostats...)
+// so a device binary only needs to wire up its pins and hand the capabilities to Run.
+package device
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// Capability is one part of a device, like a switch or a thermometer.
+type Capability interface {
+	// Attach adds the capability state to the node's device and registers any request callbacks on the node.
+	Attach(n *rnet.Node)
+	// Tick reads sensors and acts on requests. Returns true if the device state changed.
+	Tick(now time.Time) bool
+}
+
+// Run attaches the capabilities to the node and runs it until the context is done.
+// Every poll all capabilities are ticked in order and the device is published if any of them changed it.
+// Capabilities that are io.Closers are closed once it stops.
+func Run(ctx context.Context, n *rnet.Node, interval time.Duration, caps ...Capability) {
+	for _, c := range caps {
+		c.Attach(n)
+		if cl, ok := c.(io.Closer); ok {
+			defer cl.Close()
+		}
+	}
+	n.Run(ctx, interval, func() {
+		changed := false
+		now := time.Now()
+		for _, c := range caps {
+			if c.Tick(now) {
+				changed = true
+			}
+		}
+		if changed {
+			n.Publish()
+		}
+	})
+}
+
+// UntilInterrupt returns a context that is done once the process gets CTRL+C,
+// so Run returns and the capabilities release their pins.
+func UntilInterrupt() context.Context {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	return ctx
+}
@@ -0,0 +1,113 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// door tracks the travel of a portal between its limit switches.
+// It turns raw switch readings into a PortalState and verifies that
+// a requested move actually finishes within the travel timeout.
+type door struct {
+	hasOpenSwitch bool          // true if there is a limit switch for fully open
+	timeout       time.Duration // how long a full open/close should take at most
+
+	state   refuge.PortalState
+	target  refuge.PortalState // end state we are moving towards, unknown if not moving
+	request bool               // true if the current move was requested over the network
+	started time.Time          // when the current move started
+	left    bool               // true once the door is off the limit switch it started on
+}
+
+// start records that we triggered the opener to move towards the target state.
+func (d *door) start(target refuge.PortalState, now time.Time) {
+	d.target = target
+	d.request = true
+	d.started = now
+	d.left = false
+	if target == refuge.PortalStateOpen {
+		d.state = refuge.PortalStateOpening
+	} else {
+		d.state = refuge.PortalStateClosing
+	}
+}
+
+// moving returns true if the door is currently travelling.
+func (d *door) moving() bool {
+	return d.target != refuge.PortalStateUnknown
+}
+
+// update takes the current limit switch readings and returns the new state of the door.
+func (d *door) update(closed, open bool, now time.Time) refuge.PortalState {
+	if d.moving() {
+		d.travel(closed, open, now)
+		return d.state
+	}
+	switch {
+	case d.state == refuge.PortalStateObstructed && !d.left && (closed || open && d.hasOpenSwitch):
+		// Never left the switch it started on, stays obstructed until it moves.
+	case closed:
+		d.finish(refuge.PortalStateClosed)
+	case open && d.hasOpenSwitch:
+		d.finish(refuge.PortalStateOpen)
+	default:
+		// Between the limits and we didn't ask it to move.
+		d.left = true
+		switch d.state {
+		case refuge.PortalStateClosed:
+			// Someone else started opening it (wall button, remote)
+			d.target, d.request, d.started, d.left = refuge.PortalStateOpen, false, now, true
+			d.state = refuge.PortalStateOpening
+		case refuge.PortalStateOpen:
+			if d.hasOpenSwitch {
+				d.target, d.request, d.started, d.left = refuge.PortalStateClosed, false, now, true
+				d.state = refuge.PortalStateClosing
+			}
+		case refuge.PortalStateUnknown:
+			if d.hasOpenSwitch {
+				d.state = refuge.PortalStateStopped
+			} else {
+				d.state = refuge.PortalStateOpen // Best we can do with only one switch.
+			}
+		}
+	}
+	return d.state
+}
+
+// travel checks a move against the limit switches. The move only finishes on the switch it is moving towards,
+// the switch it started on only counts once the door has left it, like when the opener reverses.
+func (d *door) travel(closed, open bool, now time.Time) {
+	from, onTarget, onStart := refuge.PortalStateOpen, closed, open && d.hasOpenSwitch
+	if d.target == refuge.PortalStateOpen {
+		from, onTarget, onStart = refuge.PortalStateClosed, onStart, closed
+	}
+	if !onStart {
+		d.left = true
+	}
+	switch {
+	case onTarget:
+		d.finish(d.target)
+	case onStart && d.left:
+		d.finish(from)
+	case now.Sub(d.started) > d.timeout:
+		if d.target == refuge.PortalStateOpen && !d.hasOpenSwitch && d.left {
+			// Without an open limit switch the best we can verify is that it left closed.
+			d.finish(refuge.PortalStateOpen)
+			break
+		}
+		if d.request {
+			fmt.Printf("Portal failed to reach %s after %s\n", d.target, d.timeout)
+			d.finish(refuge.PortalStateObstructed)
+		} else {
+			d.finish(refuge.PortalStateStopped)
+		}
+	}
+}
+
+func (d *door) finish(state refuge.PortalState) {
+	d.state = state
+	d.target = refuge.PortalStateUnknown
+	d.request = false
+}
@@ -0,0 +1,116 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// doorStep is the limit switches at a time into a move and the state the door should be in.
+type doorStep struct {
+	at           time.Duration
+	closed, open bool
+	want         refuge.PortalState
+}
+
+func TestDoorTravel(t *testing.T) {
+	tests := []struct {
+		name          string
+		hasOpenSwitch bool
+		from          refuge.PortalState
+		target        refuge.PortalState
+		steps         []doorStep
+	}{
+		{
+			name: "opens", hasOpenSwitch: true, from: refuge.PortalStateClosed, target: refuge.PortalStateOpen,
+			steps: []doorStep{
+				{at: 200 * time.Millisecond, closed: true, want: refuge.PortalStateOpening},
+				{at: 2 * time.Second, want: refuge.PortalStateOpening},
+				{at: 10 * time.Second, open: true, want: refuge.PortalStateOpen},
+			},
+		},
+		{
+			name: "ignored pulse", hasOpenSwitch: true, from: refuge.PortalStateClosed, target: refuge.PortalStateOpen,
+			steps: []doorStep{
+				{at: 200 * time.Millisecond, closed: true, want: refuge.PortalStateOpening},
+				{at: 10 * time.Second, closed: true, want: refuge.PortalStateOpening},
+				{at: 16 * time.Second, closed: true, want: refuge.PortalStateObstructed},
+				{at: 18 * time.Second, closed: true, want: refuge.PortalStateObstructed},
+			},
+		},
+		{
+			name: "closes", hasOpenSwitch: true, from: refuge.PortalStateOpen, target: refuge.PortalStateClosed,
+			steps: []doorStep{
+				{at: 200 * time.Millisecond, open: true, want: refuge.PortalStateClosing},
+				{at: 2 * time.Second, want: refuge.PortalStateClosing},
+				{at: 10 * time.Second, closed: true, want: refuge.PortalStateClosed},
+			},
+		},
+		{
+			name: "close ignored", hasOpenSwitch: true, from: refuge.PortalStateOpen, target: refuge.PortalStateClosed,
+			steps: []doorStep{
+				{at: 200 * time.Millisecond, open: true, want: refuge.PortalStateClosing},
+				{at: 16 * time.Second, open: true, want: refuge.PortalStateObstructed},
+			},
+		},
+		{
+			name: "reversed", hasOpenSwitch: true, from: refuge.PortalStateOpen, target: refuge.PortalStateClosed,
+			steps: []doorStep{
+				{at: 2 * time.Second, want: refuge.PortalStateClosing},
+				{at: 8 * time.Second, open: true, want: refuge.PortalStateOpen},
+			},
+		},
+		{
+			name: "stuck between", hasOpenSwitch: true, from: refuge.PortalStateClosed, target: refuge.PortalStateOpen,
+			steps: []doorStep{
+				{at: 2 * time.Second, want: refuge.PortalStateOpening},
+				{at: 16 * time.Second, want: refuge.PortalStateObstructed},
+			},
+		},
+		{
+			name: "opens without open switch", from: refuge.PortalStateClosed, target: refuge.PortalStateOpen,
+			steps: []doorStep{
+				{at: 200 * time.Millisecond, closed: true, want: refuge.PortalStateOpening},
+				{at: 2 * time.Second, want: refuge.PortalStateOpening},
+				{at: 16 * time.Second, want: refuge.PortalStateOpen},
+			},
+		},
+		{
+			name: "ignored pulse without open switch", from: refuge.PortalStateClosed, target: refuge.PortalStateOpen,
+			steps: []doorStep{
+				{at: 16 * time.Second, closed: true, want: refuge.PortalStateObstructed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+			d := &door{hasOpenSwitch: tt.hasOpenSwitch, timeout: 15 * time.Second, state: tt.from}
+			d.start(tt.target, start)
+			for _, s := range tt.steps {
+				if got := d.update(s.closed, s.open, start.Add(s.at)); got != s.want {
+					t.Fatalf("at %s (closed %v, open %v) got %s, want %s", s.at, s.closed, s.open, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDoorUnrequested(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := &door{hasOpenSwitch: true, timeout: 15 * time.Second}
+	if got := d.update(true, false, now); got != refuge.PortalStateClosed {
+		t.Fatalf("on closed switch got %s", got)
+	}
+	// Opened with the wall button.
+	if got := d.update(false, false, now.Add(time.Second)); got != refuge.PortalStateOpening {
+		t.Fatalf("left closed switch got %s", got)
+	}
+	if got := d.update(false, false, now.Add(20*time.Second)); got != refuge.PortalStateStopped {
+		t.Fatalf("stopped between got %s", got)
+	}
+	if got := d.update(true, false, now.Add(30*time.Second)); got != refuge.PortalStateClosed {
+		t.Fatalf("back on closed switch got %s", got)
+	}
+}
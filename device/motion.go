@@ -0,0 +1,74 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// Motion is a motion sensor. The device reports the time motion was last seen and whether it is still going on.
+type Motion struct {
+	source     sensor.MotionEvents
+	reading    bool
+	lastMotion time.Time
+	state      *refuge.Motion
+}
+
+// NewMotion creates a motion sensor watching the pin, which is high while there is motion.
+// See sensor.MotionSource for the debounce and hold times.
+func NewMotion(pin gpio.Pin, debounce, hold time.Duration) *Motion {
+	return NewMotionFrom(sensor.NewMotionSource(pin, debounce, hold))
+}
+
+// NewMotionFrom creates a motion sensor from the events of the source, like one being recorded.
+func NewMotionFrom(src sensor.MotionEvents) *Motion {
+	return &Motion{source: src, lastMotion: time.Now()}
+}
+
+// Attach implements Capability.
+func (m *Motion) Attach(n *rnet.Node) {
+	m.state = &refuge.Motion{Motion: m.lastMotion.Unix()}
+	n.Device.Motion = m.state
+}
+
+// Tick implements Capability.
+// The device only changes when the sensor starts or stops seeing motion.
+func (m *Motion) Tick(now time.Time) bool {
+	changed := false
+	for {
+		select {
+		case ev, ok := <-m.source.Events():
+			if !ok {
+				return changed // Closed, nothing more will happen.
+			}
+			m.lastMotion = ev.Time
+			if ev.Motion != m.reading {
+				fmt.Printf("Motion State Changed to: %v at %s\n", ev.Motion, ev.Time.Format("Jan 2 15:04:05"))
+				m.reading = ev.Motion
+				m.state.Motion = m.lastMotion.Unix()
+				m.state.Active = m.reading
+				changed = true
+			}
+		default:
+			if m.reading {
+				m.lastMotion = now
+			}
+			return changed
+		}
+	}
+}
+
+// LastMotion returns when motion was last seen.
+func (m *Motion) LastMotion() time.Time {
+	return m.lastMotion
+}
+
+// Close stops watching the sensor.
+func (m *Motion) Close() error {
+	m.source.Close()
+	return nil
+}
@@ -0,0 +1,40 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// testEvents is a MotionEvents whose events are sent by the test.
+type testEvents struct {
+	events chan sensor.MotionEvent
+}
+
+func (e *testEvents) Events() <-chan sensor.MotionEvent { return e.events }
+func (e *testEvents) Close()                            {}
+
+func TestMotionActive(t *testing.T) {
+	src := &testEvents{events: make(chan sensor.MotionEvent, 4)}
+	m := NewMotionFrom(src)
+	n := &rnet.Node{Device: &refuge.Device{}}
+	m.Attach(n)
+	start := time.Now()
+
+	src.events <- sensor.MotionEvent{Motion: true, Time: start}
+	if !m.Tick(start) || !n.Device.Motion.Active || n.Device.Motion.Motion != start.Unix() {
+		t.Fatalf("motion start published as %+v", *n.Device.Motion)
+	}
+	// Motion going on doesn't change the device, but is the last motion seen.
+	later := start.Add(time.Hour)
+	if m.Tick(later) || !m.LastMotion().Equal(later) {
+		t.Fatalf("ongoing motion changed the device or last motion is %s", m.LastMotion())
+	}
+	src.events <- sensor.MotionEvent{Motion: false, Time: later}
+	if !m.Tick(later.Add(time.Second)) || n.Device.Motion.Active || n.Device.Motion.Motion != later.Unix() {
+		t.Fatalf("motion end published as %+v", *n.Device.Motion)
+	}
+}
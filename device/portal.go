@@ -0,0 +1,134 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// PortalPins are the pins of a portal. Leave any the portal doesn't have nil.
+type PortalPins struct {
+	Control    gpio.Pin // Output pulsed low to trigger the opener.
+	Closed     gpio.Pin // Limit switch input, high when the portal is fully closed.
+	Open       gpio.Pin // Limit switch input, high when the portal is fully open.
+	Lock       gpio.Pin // Output driving the lock actuator, low is locked.
+	LockSensor gpio.Pin // Input, high when the lock is engaged.
+}
+
+// readDelay is how often the portal sensors are read while it isn't moving.
+const readDelay = time.Second * 2
+
+// Portal is a door or window that can be monitored and optionally opened/closed and locked.
+type Portal struct {
+	pins      PortalPins
+	door      *door
+	state     *refuge.Portal
+	published refuge.Portal
+	requested refuge.Portal // Requests are acted on in the next tick.
+	lastRead  time.Time
+}
+
+// NewPortal creates a portal. Travel is how long it may take to open/close before it is considered obstructed.
+func NewPortal(pins PortalPins, travel time.Duration) *Portal {
+	for _, in := range []gpio.Pin{pins.Closed, pins.Open, pins.LockSensor} {
+		if in != nil {
+			in.Pull(gpio.PullDown) // Make sure default state is low
+			in.Input()             // Now read for state to go high
+		}
+	}
+	if pins.Control != nil {
+		// Set switch to off
+		pins.Control.Output()
+		pins.Control.High()
+	}
+	if pins.Lock != nil {
+		// Lock actuator starts unlocked so we never lock someone out on a restart.
+		pins.Lock.Output()
+		pins.Lock.High()
+	}
+	return &Portal{
+		pins:     pins,
+		door:     &door{hasOpenSwitch: pins.Open != nil, timeout: travel},
+		lastRead: time.Now(),
+	}
+}
+
+// Attach implements Capability.
+func (p *Portal) Attach(n *rnet.Node) {
+	p.state = &refuge.Portal{}
+	if p.pins.Lock != nil || p.pins.LockSensor != nil {
+		p.state.Lock = refuge.LockStateUnlocked
+	}
+	p.published = *p.state
+	n.Device.Portal = p.state
+	n.OnPortal = func(req refuge.Portal) {
+		fmt.Printf("Newly requested state: %s, lock: %s\n", req.State, req.Lock)
+		p.requested = req
+	}
+}
+
+// Tick implements Capability.
+func (p *Portal) Tick(now time.Time) bool {
+	// 1. check sensors every "readDelay", every tick while the portal is moving.
+	if now.Sub(p.lastRead) > readDelay || p.door.moving() {
+		if p.pins.Closed != nil {
+			// Check to see if portal is open
+			ns := p.door.update(p.pins.Closed.Read(), p.pins.Open != nil && p.pins.Open.Read(), now)
+			if p.state.State != ns {
+				fmt.Printf("New Door State: %s\n", ns)
+				p.state.State = ns
+			}
+		}
+		if p.pins.LockSensor != nil {
+			// Check to see if the lock is engaged
+			ls := refuge.LockStateUnlocked
+			if p.pins.LockSensor.Read() {
+				ls = refuge.LockStateLocked
+			}
+			if p.state.Lock != ls {
+				fmt.Printf("New Lock State: %s\n", ls)
+				p.state.Lock = ls
+			}
+		}
+		p.lastRead = now
+	}
+
+	// 2. Act on any request
+	acted := false
+	req := p.requested
+	p.requested = refuge.Portal{}
+	// If v != current state, trigger the portal to open
+	validRequest := req.State == refuge.PortalStateOpen || req.State == refuge.PortalStateClosed
+	if p.pins.Control != nil && validRequest && req.State != p.state.State && !p.door.moving() {
+		p.pins.Control.Low()
+		time.Sleep(time.Millisecond * 100)
+		p.pins.Control.High()
+		p.door.start(req.State, now)
+		p.state.State = p.door.state
+		acted = true
+	}
+	if p.pins.Lock != nil && req.Lock != refuge.LockStateUnknown && req.Lock != p.state.Lock {
+		if req.Lock == refuge.LockStateLocked {
+			p.pins.Lock.Low()
+		} else {
+			p.pins.Lock.High()
+		}
+		if p.pins.LockSensor == nil {
+			// Without a sensor the best we can do is trust the actuator.
+			p.state.Lock = req.Lock
+		}
+		acted = true
+	}
+	if acted {
+		p.lastRead = now.Add(-readDelay + time.Second) // force a re-read in 1 second
+	}
+
+	if *p.state == p.published {
+		return false
+	}
+	p.published = *p.state
+	return true
+}
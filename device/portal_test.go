@@ -0,0 +1,147 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+func TestSwitchRelay(t *testing.T) {
+	pin := gpio.NewFake().FakePin(4)
+	s := NewSwitch(pin)
+	if !pin.IsOutput() || !pin.Level() {
+		t.Fatal("relay isn't an output driven high at start")
+	}
+	n := &rnet.Node{Device: &refuge.Device{}}
+	s.Attach(n)
+	now := time.Now()
+	if s.Tick(now) {
+		t.Fatal("changed without a request")
+	}
+
+	n.OnSwitch(refuge.Switch{On: false})
+	if pin.Level() || n.Device.Switch.On {
+		t.Fatal("relay not driven low when switched off")
+	}
+	if !s.Tick(now) || s.Tick(now) {
+		t.Fatal("switching off should change the device once")
+	}
+	n.OnSwitch(refuge.Switch{On: true})
+	if !pin.Level() || !n.Device.Switch.On {
+		t.Fatal("relay not driven high when switched on")
+	}
+}
+
+// testPortal is a portal on fake pins, the control pin records every pulse.
+type testPortal struct {
+	*Portal
+	node    *rnet.Node
+	closed  *gpio.FakePin
+	open    *gpio.FakePin
+	lock    *gpio.FakePin
+	pulses  int
+	started time.Time
+}
+
+func newTestPortal(t *testing.T) *testPortal {
+	board := gpio.NewFake()
+	tp := &testPortal{
+		node:    &rnet.Node{Device: &refuge.Device{}},
+		closed:  board.FakePin(17),
+		open:    board.FakePin(18),
+		lock:    board.FakePin(27),
+		started: time.Now(),
+	}
+	control := board.FakePin(4)
+	control.OnWrite = func(high bool) {
+		if !high {
+			tp.pulses++
+		}
+	}
+	tp.closed.Set(true)
+	tp.Portal = NewPortal(PortalPins{Control: control, Closed: tp.closed, Open: tp.open, Lock: tp.lock}, 15*time.Second)
+	if !control.IsOutput() || !control.Level() || tp.closed.IsOutput() || tp.closed.Pulled() != gpio.PullDown {
+		t.Fatal("portal pins not set up as a high control output and pulled down inputs")
+	}
+	tp.Attach(tp.node)
+	tp.Tick(tp.started.Add(3 * time.Second))
+	if tp.node.Device.Portal.State != refuge.PortalStateClosed {
+		t.Fatalf("portal on its closed switch is %s", tp.node.Device.Portal.State)
+	}
+	return tp
+}
+
+// tick runs the portal at d after it started and returns its state.
+func (tp *testPortal) tick(d time.Duration) refuge.PortalState {
+	tp.Tick(tp.started.Add(d))
+	return tp.node.Device.Portal.State
+}
+
+func TestPortalOpens(t *testing.T) {
+	tp := newTestPortal(t)
+	tp.node.OnPortal(refuge.Portal{State: refuge.PortalStateOpen})
+	if got := tp.tick(4 * time.Second); got != refuge.PortalStateOpening || tp.pulses != 1 {
+		t.Fatalf("after the open request got %s with %d pulses", got, tp.pulses)
+	}
+	// Still on the closed switch right after the pulse.
+	if got := tp.tick(4*time.Second + 200*time.Millisecond); got != refuge.PortalStateOpening {
+		t.Fatalf("before leaving the closed switch got %s", got)
+	}
+	tp.closed.Set(false)
+	if got := tp.tick(6 * time.Second); got != refuge.PortalStateOpening {
+		t.Fatalf("between the limits got %s", got)
+	}
+	tp.open.Set(true)
+	if got := tp.tick(14 * time.Second); got != refuge.PortalStateOpen {
+		t.Fatalf("on the open switch got %s", got)
+	}
+	// Asking for the state it is already in doesn't pulse the opener.
+	tp.node.OnPortal(refuge.Portal{State: refuge.PortalStateOpen})
+	tp.tick(15 * time.Second)
+	if tp.pulses != 1 {
+		t.Fatalf("opener pulsed %d times", tp.pulses)
+	}
+}
+
+func TestPortalObstructed(t *testing.T) {
+	tp := newTestPortal(t)
+	tp.node.OnPortal(refuge.Portal{State: refuge.PortalStateOpen})
+	tp.tick(4 * time.Second)
+	// The opener ignores the pulse, the portal never leaves the closed switch.
+	if got := tp.tick(10 * time.Second); got != refuge.PortalStateOpening {
+		t.Fatalf("before the travel time got %s", got)
+	}
+	if got := tp.tick(20 * time.Second); got != refuge.PortalStateObstructed {
+		t.Fatalf("after the travel time got %s", got)
+	}
+	if got := tp.tick(25 * time.Second); got != refuge.PortalStateObstructed {
+		t.Fatalf("still on the closed switch got %s", got)
+	}
+	// Asking again retries.
+	tp.node.OnPortal(refuge.Portal{State: refuge.PortalStateOpen})
+	if got := tp.tick(26 * time.Second); got != refuge.PortalStateOpening || tp.pulses != 2 {
+		t.Fatalf("retry got %s with %d pulses", got, tp.pulses)
+	}
+}
+
+func TestPortalLock(t *testing.T) {
+	tp := newTestPortal(t)
+	if !tp.lock.IsOutput() || !tp.lock.Level() || tp.node.Device.Portal.Lock != refuge.LockStateUnlocked {
+		t.Fatal("lock doesn't start unlocked")
+	}
+	tp.node.OnPortal(refuge.Portal{Lock: refuge.LockStateLocked})
+	if !tp.Tick(tp.started.Add(4*time.Second)) || tp.lock.Level() || tp.node.Device.Portal.Lock != refuge.LockStateLocked {
+		t.Fatal("lock not driven low and reported locked")
+	}
+	if tp.pulses != 0 {
+		t.Fatal("locking pulsed the opener")
+	}
+	tp.node.OnPortal(refuge.Portal{Lock: refuge.LockStateUnlocked})
+	tp.Tick(tp.started.Add(5 * time.Second))
+	if !tp.lock.Level() || tp.node.Device.Portal.Lock != refuge.LockStateUnlocked {
+		t.Fatal("lock not driven high and reported unlocked")
+	}
+}
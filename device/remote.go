@@ -0,0 +1,101 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// DefaultStale is how old remote temp readings can get before the thermostat falls back to its own thermometer.
+const DefaultStale = time.Minute * 10
+
+// remoteTemps holds the latest reading of each remote temp source.
+type remoteTemps struct {
+	sources  []refuge.TempSource
+	stale    time.Duration
+	readings map[refuge.TempSource]remoteReading
+}
+
+type remoteReading struct {
+	temp, humi float32
+	at         time.Time // When the thermometer took the reading, as near as we can tell.
+}
+
+// update stores the reading if it is from one of the sources.
+// Returns true if it did, even if the reading didn't change, so Control runs again for a steady temp too
+// and can finish what the min run/off times held back.
+func (r *remoteTemps) update(rt refuge.RemoteTemp, now time.Time) bool {
+	found := false
+	for _, s := range r.sources {
+		found = found || s == rt.Source
+	}
+	if !found {
+		return false
+	}
+	if r.readings == nil {
+		r.readings = map[refuge.TempSource]remoteReading{}
+	}
+	r.readings[rt.Source] = remoteReading{
+		temp: rt.Temp,
+		humi: rt.Humidity,
+		at:   now.Add(-time.Duration(rt.Age) * time.Second),
+	}
+	return true
+}
+
+// reading returns the weighted average of the sources that aren't stale.
+// Returns false if they are all stale.
+func (r *remoteTemps) reading(now time.Time) (float32, float32, bool) {
+	var temp, humi, total float32
+	for _, s := range r.sources {
+		rd, ok := r.readings[s]
+		if !ok || now.Sub(rd.at) > r.stale {
+			continue
+		}
+		w := s.Weight
+		if w <= 0 {
+			w = 1
+		}
+		temp += rd.temp * w
+		humi += rd.humi * w
+		total += w
+	}
+	if total == 0 {
+		return 0, 0, false
+	}
+	return temp / total, humi / total, true
+}
+
+// ParseSources parses a comma separated list of temp sources.
+// Each source is a device ID, or 'room:' followed by a room ID, optionally followed by '=' and its weight.
+// For example: 'room:liv=2,8f3a09c2d1e4b5a6'.
+func ParseSources(list string) ([]refuge.TempSource, error) {
+	sources := []refuge.TempSource{}
+	if list == "" {
+		return sources, nil
+	}
+	for _, entry := range strings.Split(list, ",") {
+		src := refuge.TempSource{}
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			w, err := strconv.ParseFloat(entry[i+1:], 32)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("invalid weight in temp source %q", entry)
+			}
+			src.Weight = float32(w)
+			entry = entry[:i]
+		}
+		if strings.HasPrefix(entry, "room:") {
+			src.Room = strings.TrimPrefix(entry, "room:")
+		} else {
+			src.ID = entry
+		}
+		if src.ID == "" && src.Room == "" {
+			return nil, fmt.Errorf("empty temp source in %q", list)
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
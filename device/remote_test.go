@@ -0,0 +1,79 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+var (
+	kitchen = refuge.TempSource{ID: "kitchen", Weight: 3}
+	bedroom = refuge.TempSource{Room: "bed"} // Weight 0 counts as 1.
+)
+
+func TestRemoteTemps(t *testing.T) {
+	now := time.Now()
+	fresh := func(src refuge.TempSource, temp float32) refuge.RemoteTemp {
+		return refuge.RemoteTemp{Source: src, Temp: temp, Humidity: temp * 2, Age: 60}
+	}
+	stale := func(src refuge.TempSource, temp float32) refuge.RemoteTemp {
+		return refuge.RemoteTemp{Source: src, Temp: temp, Humidity: temp * 2, Age: uint32(DefaultStale/time.Second) + 1}
+	}
+
+	tests := []struct {
+		name string
+		recv []refuge.RemoteTemp
+		temp float32
+		ok   bool
+	}{
+		{"nothing yet", nil, 0, false},
+		{"weighted", []refuge.RemoteTemp{fresh(kitchen, 20), fresh(bedroom, 24)}, 21, true},
+		{"one fresh one stale", []refuge.RemoteTemp{fresh(kitchen, 20), stale(bedroom, 24)}, 20, true},
+		{"all stale", []refuge.RemoteTemp{stale(kitchen, 20), stale(bedroom, 24)}, 0, false},
+		{"latest reading wins", []refuge.RemoteTemp{stale(bedroom, 10), fresh(bedroom, 22)}, 22, true},
+		{"other sources ignored", []refuge.RemoteTemp{fresh(bedroom, 22), fresh(refuge.TempSource{ID: "garage"}, 5)}, 22, true},
+	}
+	for _, tt := range tests {
+		r := remoteTemps{sources: []refuge.TempSource{kitchen, bedroom}, stale: DefaultStale}
+		for _, rt := range tt.recv {
+			r.update(rt, now)
+		}
+		temp, humi, ok := r.reading(now)
+		if ok != tt.ok || abs(temp-tt.temp) > 0.001 || abs(humi-tt.temp*2) > 0.001 {
+			t.Errorf("%s: got %.2fC %.2f%% (%v), want %.2fC (%v)", tt.name, temp, humi, ok, tt.temp, tt.ok)
+		}
+	}
+
+	r := remoteTemps{sources: []refuge.TempSource{kitchen}, stale: DefaultStale}
+	if r.update(refuge.RemoteTemp{Source: refuge.TempSource{ID: "garage"}}, now) || len(r.readings) != 0 {
+		t.Error("reading of another source stored")
+	}
+}
+
+func TestThermostatRemoteFallback(t *testing.T) {
+	ts := NewThermostat(&climate.FakeController{}, climate.DefaultOptions, NewThermometer(&testSensor{temps: []float32{18, 18}}, time.Minute), nil)
+	ts.UseSources([]refuge.TempSource{kitchen, bedroom}, DefaultStale)
+	ts.therm.state = &refuge.Thermometer{} // Set by Attach.
+	now := time.Now()
+	ts.therm.update(now, true)
+
+	// The kitchen is fresh and the bedroom stale, only the kitchen is used.
+	ts.remote.update(refuge.RemoteTemp{Source: kitchen, Temp: 22, Humidity: 40, Age: 30}, now)
+	ts.remote.update(refuge.RemoteTemp{Source: bedroom, Temp: 26, Humidity: 40, Age: 3600}, now)
+	ts.runControl = true
+	ts.Tick(now)
+	if ts.state.Temp != 22 || !ts.state.Remote {
+		t.Fatalf("controlled on %.1fC remote %v, want the kitchen's 22C", ts.state.Temp, ts.state.Remote)
+	}
+
+	// Once the kitchen goes stale too, the thermostat's own thermometer is used.
+	later := now.Add(DefaultStale)
+	ts.therm.update(later, true)
+	ts.runControl = true
+	ts.Tick(later)
+	if ts.state.Temp != 18 || ts.state.Remote {
+		t.Fatalf("controlled on %.1fC remote %v, want the local 18C", ts.state.Temp, ts.state.Remote)
+	}
+}
@@ -0,0 +1,119 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// thermostatState is what a thermostat saves to keep its settings across restarts.
+type thermostatState struct {
+	Settings refuge.Settings
+	Schedule refuge.Schedule
+	Block    *refuge.ScheduleBlock // Block active when saved, an override only holds while it is still active.
+	Override bool
+	Setback  *refuge.Setback // nil in files saved before setbacks could be changed, keeps the default.
+}
+
+// valid checks that the settings are something the thermostat could have been set to.
+func (s thermostatState) valid() error {
+	if err := validSettings(s.Settings); err != nil {
+		return err
+	}
+	if sb := s.Setback; sb != nil && (sb.Heat < 0 || sb.Heat > 10 || sb.Cool < 0 || sb.Cool > 10) {
+		return fmt.Errorf("setback %.1f/%.1f is out of range", sb.Heat, sb.Cool)
+	}
+	for _, b := range s.Schedule.Blocks {
+		if b.Day > 6 || b.Minute >= 24*60 {
+			return fmt.Errorf("schedule block at day %d minute %d is out of range", b.Day, b.Minute)
+		}
+		if err := validSettings(b.Settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thermometerState is what a thermometer saves to keep the calibration set over the network across restarts.
+type thermometerState struct {
+	Calibration refuge.Calibration
+}
+
+func (s thermometerState) valid() error {
+	return validCalibration(s.Calibration)
+}
+
+// validCalibration checks the calibration is a correction a sensor could plausibly need.
+func validCalibration(c refuge.Calibration) error {
+	if c.TempOffset < -10 || c.TempOffset > 10 || c.HumiOffset < -30 || c.HumiOffset > 30 {
+		return fmt.Errorf("calibration offsets %.1fC/%.1f%% are out of range", c.TempOffset, c.HumiOffset)
+	}
+	for _, scale := range []float32{c.TempScale, c.HumiScale} {
+		if scale != 0 && (scale < 0.5 || scale > 1.5) {
+			return fmt.Errorf("calibration scale %.2f is out of range", scale)
+		}
+	}
+	return nil
+}
+
+func validSettings(s refuge.Settings) error {
+	if s.Low < 0 || s.High > 40 || s.Low > s.High {
+		return fmt.Errorf("settings %.1f-%.1f are out of range", s.Low, s.High)
+	}
+	if s.Mode > refuge.ModeEmergencyHeat {
+		return fmt.Errorf("unknown mode %d", s.Mode)
+	}
+	return nil
+}
+
+// savedState is a state a device saves to a file.
+type savedState interface {
+	valid() error
+}
+
+// loadState reads the saved state into s.
+// A missing file returns false without an error, anything unreadable or invalid returns the error.
+func loadState(path string, s savedState) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return false, err
+	}
+	if err := s.valid(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// saveState writes the state to a temp file next to path and renames it into place,
+// so a power loss part way through leaves either the old or the new state and never a partial file.
+func saveState(path string, s savedState) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails once renamed, cleans up if anything went wrong.
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
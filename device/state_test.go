@@ -0,0 +1,133 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+func stateDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+var testState = thermostatState{
+	Settings: refuge.Settings{Low: 18, High: 24, Mode: refuge.ModeFan},
+	Schedule: refuge.Schedule{Blocks: []refuge.ScheduleBlock{
+		{Day: 1, Minute: 6 * 60, Settings: refuge.Settings{Low: 20, High: 24}},
+		{Day: 1, Minute: 22 * 60, Settings: refuge.Settings{Low: 17, High: 24}},
+	}},
+	Override: true,
+	Setback:  &refuge.Setback{Enabled: true, AwayMinutes: 60, Heat: 3, Cool: 2},
+}
+
+func TestLoadState(t *testing.T) {
+	dir := stateDir(t)
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "good")
+	if err := saveState(good, testState); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte // nil for no file
+		ok   bool
+		err  bool
+	}{
+		{"missing", nil, false, false},
+		{"good", data, true, false},
+		{"empty", []byte{}, false, true},
+		{"truncated", data[:len(data)/2], false, true},
+		{"invalid bytes", []byte{0x00, 0xff, 0xfe, 0x7b, 0x01}, false, true},
+		{"out of range", []byte(`{"Settings":{"Low":30,"High":20}}`), false, true},
+		{"bad schedule", []byte(`{"Settings":{"Low":18,"High":24},"Schedule":{"Blocks":[{"Day":9}]}}`), false, true},
+		{"bad setback", []byte(`{"Settings":{"Low":18,"High":24},"Setback":{"Heat":50}}`), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "test.state")
+			os.Remove(path)
+			if tt.data != nil {
+				if err := ioutil.WriteFile(path, tt.data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := thermostatState{}
+			ok, err := loadState(path, &s)
+			if ok != tt.ok || (err != nil) != tt.err {
+				t.Fatalf("got %v, %v, want ok %v and error %v", ok, err, tt.ok, tt.err)
+			}
+			if ok && !reflect.DeepEqual(s, testState) {
+				t.Errorf("loaded %+v, want %+v", s, testState)
+			}
+		})
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	dir := stateDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "thermo.state")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveState(path, testState); err != nil {
+		t.Fatal(err)
+	}
+	s := thermostatState{}
+	if ok, err := loadState(path, &s); !ok || err != nil || !reflect.DeepEqual(s, testState) {
+		t.Fatalf("round trip got %+v (%v, %v), want %+v", s, ok, err, testState)
+	}
+	// The temp file was renamed into place, nothing is left next to it.
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "thermo.state" {
+		t.Errorf("files left in the state dir: %v", files)
+	}
+
+	if err := saveState(filepath.Join(dir, "missing", "thermo.state"), testState); err == nil {
+		t.Error("saved into a dir that doesn't exist")
+	}
+}
+
+func TestThermostatPersist(t *testing.T) {
+	dir := stateDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "thermo.state")
+	newThermostat := func() *Thermostat {
+		return NewThermostat(&climate.FakeController{}, climate.DefaultOptions, NewThermometer(&testSensor{}, time.Minute), nil)
+	}
+
+	// A corrupt file falls back to the defaults, and is replaced on the next change.
+	if err := ioutil.WriteFile(path, []byte(`{"Settings":{"Low":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := newThermostat()
+	ts.Persist(path)
+	if ts.state.Settings != DefaultSettings || ts.state.Setback != climate.DefaultSetback {
+		t.Fatalf("corrupt file restored %+v", ts.state.Settings)
+	}
+	ts.apply(refuge.Settings{Low: 21, High: 23})
+	ts.save()
+
+	restored := newThermostat()
+	restored.Persist(path)
+	want := refuge.Settings{Low: 21, High: 23, Mode: DefaultSettings.Mode}
+	if restored.state.Settings != want {
+		t.Errorf("restored %+v, want %+v", restored.state.Settings, want)
+	}
+}
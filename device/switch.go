@@ -0,0 +1,48 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+)
+
+// Switch is a relay that turns something on and off.
+type Switch struct {
+	pin     gpio.Pin
+	state   *refuge.Switch
+	changed bool
+}
+
+// NewSwitch creates a switch driving the relay on the pin.
+func NewSwitch(pin gpio.Pin) *Switch {
+	// Set switch to off
+	pin.Output()
+	pin.High()
+	return &Switch{pin: pin}
+}
+
+// Attach implements Capability.
+func (s *Switch) Attach(n *rnet.Node) {
+	s.state = &refuge.Switch{}
+	n.Device.Switch = s.state
+	n.OnSwitch = func(req refuge.Switch) {
+		fmt.Printf("Newly requested state: %v\n", req.On)
+		if req.On {
+			s.pin.High()
+		} else {
+			s.pin.Low()
+		}
+		s.state.On = req.On
+		s.changed = true
+	}
+}
+
+// Tick implements Capability.
+func (s *Switch) Tick(now time.Time) bool {
+	changed := s.changed
+	s.changed = false
+	return changed
+}
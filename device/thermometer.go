@@ -0,0 +1,186 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// Thermometer reads a temperature/humidity sensor and runs the readings through a calibration and filter pipeline.
+type Thermometer struct {
+	sensor    sensor.Thermometer
+	interval  time.Duration
+	pipeline  *sensor.Pipeline
+	raw       *sensor.ThermalReading // Last reading straight from the sensor, nil until the first one.
+	filtered  sensor.ThermalReading
+	lastRead  time.Time
+	lastGood  time.Time              // When the sensor last gave a reading we trust.
+	jump      *sensor.ThermalReading // Reading far off the others, kept until the next one confirms or discards it.
+	stateFile string                 // Where the calibration is saved, empty to not save it.
+	changed   bool                   // Calibrated since the last tick.
+	state     *refuge.Thermometer
+}
+
+// maxJump is how far (C) a reading can be from the last one before it has to be confirmed by the next reading.
+const maxJump = 10
+
+// NewThermometer creates a thermometer that reads from the sensor once every interval.
+// Readings are uncalibrated and smoothed with the sensor.DefaultFilter until UsePipeline is called.
+func NewThermometer(s sensor.Thermometer, interval time.Duration) *Thermometer {
+	return &Thermometer{
+		sensor:   s,
+		interval: interval,
+		pipeline: sensor.NewPipeline(sensor.Calibration{}, sensor.DefaultFilter),
+		lastGood: time.Now(),
+	}
+}
+
+// UsePipeline sets the calibration and filter readings go through.
+func (t *Thermometer) UsePipeline(cal sensor.Calibration, filter sensor.FilterConfig) {
+	t.pipeline = sensor.NewPipeline(cal, filter)
+}
+
+// Persist restores the calibration last set over the network from the file at path, replacing the one
+// passed to UsePipeline, and saves it to the file whenever it is set again.
+func (t *Thermometer) Persist(path string) {
+	t.stateFile = path
+	s := thermometerState{}
+	ok, err := loadState(path, &s)
+	if err != nil {
+		fmt.Printf("Unable to restore thermometer calibration from %s: %s\n", path, err)
+	}
+	if ok {
+		fmt.Printf("Restored thermometer calibration: %#v\n", s.Calibration)
+		t.pipeline.SetCalibration(sensor.Calibration(s.Calibration))
+	}
+}
+
+// Attach implements Capability.
+func (t *Thermometer) Attach(n *rnet.Node) {
+	t.state = &refuge.Thermometer{}
+	n.Device.Thermometer = t.state
+	t.publish()
+	n.OnCalibration = func(c refuge.Calibration) {
+		fmt.Printf("(%s) Got new calibration: %#v\n", time.Now().Format("15:04:05 MST"), c)
+		if err := validCalibration(c); err != nil {
+			fmt.Printf("Ignoring calibration: %s\n", err)
+			return
+		}
+		t.calibrate(sensor.Calibration(c))
+	}
+}
+
+// calibrate replaces the calibration and runs the last raw reading through it, so the change shows right away.
+func (t *Thermometer) calibrate(c sensor.Calibration) {
+	t.pipeline.SetCalibration(c)
+	if t.raw != nil {
+		t.filtered = t.pipeline.Add(*t.raw)
+	}
+	t.publish()
+	t.changed = true
+	if t.stateFile == "" {
+		return
+	}
+	if err := saveState(t.stateFile, thermometerState{Calibration: refuge.Calibration(c)}); err != nil {
+		fmt.Printf("Failed to save thermometer calibration to %s: %s\n", t.stateFile, err)
+	}
+}
+
+// Tick implements Capability.
+func (t *Thermometer) Tick(now time.Time) bool {
+	changed := t.changed
+	t.changed = false
+	if t.update(now, false) {
+		t.publish()
+		changed = true
+	}
+	return changed
+}
+
+// publish copies the readings, calibration and filter into the device state.
+func (t *Thermometer) publish() {
+	if t.raw != nil {
+		t.state.Temp, t.state.Humidity, t.state.Pressure = t.filtered.Temp, t.filtered.Humi, t.filtered.Pressure
+		t.state.RawTemp, t.state.RawHumidity = t.raw.Temp, t.raw.Humi
+	}
+	t.state.Calibration = refuge.Calibration(t.pipeline.Calibration())
+	t.state.Filter = t.pipeline.Filter().String()
+}
+
+// Reading returns the calibrated and filtered temperature and humidity.
+func (t *Thermometer) Reading() (float32, float32) {
+	return t.filtered.Temp, t.filtered.Humi
+}
+
+// hasReading returns true once the sensor has given a good reading.
+func (t *Thermometer) hasReading() bool {
+	return t.raw != nil
+}
+
+// LastGood returns when the sensor last gave a reading that was trusted.
+// Until the first reading it is when the thermometer was created.
+func (t *Thermometer) LastGood() time.Time {
+	return t.lastGood
+}
+
+// update reads the sensor if the interval has passed or force is set.
+// Returns true if there is a new reading.
+func (t *Thermometer) update(now time.Time, force bool) bool {
+	if now.Sub(t.lastRead) < t.interval && !force {
+		return false
+	}
+
+	fmt.Printf("(%s) Starting Reading Thermometer...\n", now.Format("15:04:05 MST"))
+	// Failed and rejected readings wait for the next interval too, only lastGood stays behind.
+	t.lastRead = now
+	includeWait := false // first reading is always waited long enough, skip straight to reading!
+	var err error
+	for i := 0; i < 10; i++ {
+		var reading sensor.ThermalReading
+		reading, err = t.sensor.Read(includeWait)
+		if err == nil {
+			reading.Time = now
+			same := false
+			if t.raw != nil {
+				diff := abs(reading.Temp - t.raw.Temp)
+				if diff > maxJump {
+					// Unlikely this big of a jump would happen, unless the next reading agrees.
+					jump := t.jump
+					t.jump = &reading
+					if jump == nil || abs(reading.Temp-jump.Temp) > maxJump {
+						fmt.Printf("Last reading >%dC different than previous readings. Waiting for the next reading to confirm it.\n", maxJump)
+						return false
+					}
+					fmt.Print("Big temp change confirmed, starting over from the new readings.\n")
+					t.pipeline.Reset()
+					t.pipeline.Add(*jump)
+				}
+				same = diff < 0.01 && abs(reading.Humi-t.raw.Humi) < 0.01
+			}
+			t.jump = nil
+			t.lastGood = now
+			last := t.filtered
+			t.raw = &reading
+			// Unchanged readings still go through the filter so it settles on them.
+			t.filtered = t.pipeline.Add(reading)
+			if same && abs(t.filtered.Temp-last.Temp) < 0.01 && abs(t.filtered.Humi-last.Humi) < 0.01 {
+				fmt.Print("no difference in last reading... ignoring reading.\n")
+				return false
+			}
+			return true
+		}
+		includeWait = true // force a wait between readings
+	}
+	fmt.Printf("Failed to read thermometer after 10 tries: %s\n", err)
+	return false
+}
+
+func abs(a float32) float32 {
+	if a >= 0 {
+		return a
+	}
+	return -a
+}
@@ -0,0 +1,82 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// testSensor returns its readings in order, failing once they run out, and counts how often it was read.
+type testSensor struct {
+	temps []float32
+	reads int
+}
+
+func (s *testSensor) Read(includeWait bool) (sensor.ThermalReading, error) {
+	s.reads++
+	if len(s.temps) == 0 {
+		return sensor.ThermalReading{}, errors.New("no answer")
+	}
+	t := s.temps[0]
+	s.temps = s.temps[1:]
+	return sensor.ThermalReading{Temp: t, Humi: 40}, nil
+}
+
+func TestThermometerInterval(t *testing.T) {
+	s := &testSensor{temps: []float32{20, 21}}
+	therm := NewThermometer(s, 2*time.Minute)
+	therm.UsePipeline(sensor.Calibration{}, sensor.FilterConfig{Kind: sensor.FilterNone})
+	start := time.Now()
+
+	if !therm.update(start, false) || s.reads != 1 {
+		t.Fatalf("first reading not taken, %d reads", s.reads)
+	}
+	if therm.update(start.Add(time.Minute), false) || s.reads != 1 {
+		t.Fatalf("read again before the interval, %d reads", s.reads)
+	}
+	if !therm.update(start.Add(2*time.Minute), false) || s.reads != 2 {
+		t.Fatalf("not read after the interval, %d reads", s.reads)
+	}
+	if temp, _ := therm.Reading(); temp != 21 {
+		t.Fatalf("got %.1fC, want 21C", temp)
+	}
+
+	// A failing sensor is retried, then left alone until the next interval.
+	if therm.update(start.Add(4*time.Minute), false) || s.reads != 12 {
+		t.Fatalf("failing sensor read %d times, want 10 more", s.reads)
+	}
+	for i := 1; i < 10; i++ {
+		therm.update(start.Add(4*time.Minute+time.Duration(i)*100*time.Millisecond), false)
+	}
+	if s.reads != 12 {
+		t.Fatalf("failing sensor read %d times before the next interval", s.reads)
+	}
+	if got := therm.LastGood(); !got.Equal(start.Add(2 * time.Minute)) {
+		t.Fatalf("last good reading at %s, want the one 2 minutes in", got.Sub(start))
+	}
+}
+
+func TestThermometerJump(t *testing.T) {
+	s := &testSensor{temps: []float32{20, 45, 20.5}}
+	therm := NewThermometer(s, 2*time.Minute)
+	therm.UsePipeline(sensor.Calibration{}, sensor.FilterConfig{Kind: sensor.FilterNone})
+	start := time.Now()
+
+	therm.update(start, false)
+	// The jump is held back until the next reading, which isn't taken right away.
+	if therm.update(start.Add(2*time.Minute), false) {
+		t.Fatal("reading 25C off the last one was used")
+	}
+	therm.update(start.Add(2*time.Minute+100*time.Millisecond), false)
+	if s.reads != 2 {
+		t.Fatalf("read %d times after the jump, want it to wait for the interval", s.reads)
+	}
+	if !therm.update(start.Add(4*time.Minute), false) {
+		t.Fatal("reading after the discarded jump not used")
+	}
+	if temp, _ := therm.Reading(); temp != 20.5 {
+		t.Fatalf("got %.1fC, want 20.5C", temp)
+	}
+}
@@ -0,0 +1,293 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/climate"
+	"gitlab.com/lologarithm/refuge/refuge"
+	"gitlab.com/lologarithm/refuge/rnet"
+	"gitlab.com/lologarithm/refuge/sensor"
+)
+
+// occupancyTimeout is how long occupancy from the server is trusted.
+// The server resends it every minute, so after this it is assumed to be down.
+const occupancyTimeout = time.Minute * 5
+
+// DefaultSettings are the thermostat settings on launch.
+var DefaultSettings = refuge.Settings{
+	Low:  19,
+	High: 26.66,
+	Mode: refuge.ModeAuto,
+}
+
+// Thermostat controls the heating/cooling system from its thermometer and motion sensor readings.
+// It drives the thermometer and motion sensor itself, so don't pass them to Run separately.
+// Settings follow the weekly schedule if one is set, until they are changed by hand.
+type Thermostat struct {
+	cl     *climate.Guard
+	therm  *Thermometer
+	motion *Motion // nil if there is no motion sensor, the house is then always considered occupied.
+
+	remoteMotion time.Time // Last motion in the room/house from the server.
+	remoteAt     time.Time // When occupancy was last received from the server.
+	remote       remoteTemps
+
+	state      *refuge.Thermostat
+	thermState *refuge.Thermometer
+	motState   *refuge.Motion
+
+	schedule  refuge.Schedule
+	stateFile string // Where settings are saved, empty to not save them.
+	dirty     bool   // Settings changed since they were last saved.
+
+	runControl bool
+	requested  bool
+}
+
+// NewThermostat creates a thermostat controlling cl, protected by the options. Motion can be nil.
+func NewThermostat(cl climate.Controller, opts climate.Options, therm *Thermometer, motion *Motion) *Thermostat {
+	return &Thermostat{
+		cl:     climate.NewGuard(cl, opts),
+		therm:  therm,
+		motion: motion,
+		state:  &refuge.Thermostat{Settings: DefaultSettings, Setback: climate.DefaultSetback},
+		remote: remoteTemps{stale: DefaultStale},
+	}
+}
+
+// UseSources makes the thermostat control on the weighted average of remote thermometers instead of its own.
+// The server sends the thermostat their readings. Sources that haven't been heard from within stale are left out,
+// and without any fresh sources the thermostat falls back to its own thermometer.
+func (t *Thermostat) UseSources(sources []refuge.TempSource, stale time.Duration) {
+	t.remote = remoteTemps{sources: sources, stale: stale}
+	t.state.Sources = sources
+}
+
+// UseOccupancy makes the setback go by the motion sensors in the thermostat's room or whole house as well as its own.
+// The server sends the thermostat their motion. If the server goes quiet only the thermostat's own sensor is used,
+// and without one the house is considered occupied.
+func (t *Thermostat) UseOccupancy(src refuge.OccupancySource) {
+	t.state.Occupancy = src
+}
+
+// ParseOccupancy returns the occupancy source with the given name: local, room or house.
+func ParseOccupancy(name string) (refuge.OccupancySource, error) {
+	switch name {
+	case "", "local":
+		return refuge.OccupancyLocal, nil
+	case "room":
+		return refuge.OccupancyRoom, nil
+	case "house":
+		return refuge.OccupancyHouse, nil
+	}
+	return refuge.OccupancyLocal, fmt.Errorf("unknown occupancy source %q, use local, room or house", name)
+}
+
+// Persist restores the settings, schedule and override from the file at path and saves them to it whenever they change.
+// If the file is missing, unreadable or invalid the thermostat starts with the DefaultSettings.
+func (t *Thermostat) Persist(path string) {
+	t.stateFile = path
+	s := thermostatState{}
+	ok, err := loadState(path, &s)
+	if err != nil {
+		fmt.Printf("Unable to restore thermostat state from %s, using defaults: %s\n", path, err)
+	}
+	if !ok {
+		return
+	}
+	fmt.Printf("Restored thermostat settings: %#v\n", s.Settings)
+	t.state.Settings = s.Settings
+	t.state.Block = s.Block
+	t.state.Override = s.Override
+	if s.Setback != nil {
+		t.state.Setback = *s.Setback
+	}
+	t.schedule = s.Schedule
+}
+
+// SetSchedule replaces the weekly schedule, the settings of its active block are applied on the next tick.
+// An empty schedule leaves the current settings as they are.
+func (t *Thermostat) SetSchedule(s refuge.Schedule) {
+	t.schedule = s
+	t.state.Block = nil
+	t.state.Override = false
+	t.dirty = true
+}
+
+// Attach implements Capability.
+func (t *Thermostat) Attach(n *rnet.Node) {
+	t.therm.Attach(n)
+	t.thermState = n.Device.Thermometer
+	onCalibration := n.OnCalibration
+	n.OnCalibration = func(c refuge.Calibration) {
+		onCalibration(c)
+		t.runControl = true
+		t.requested = true
+	}
+	if t.motion != nil {
+		t.motion.Attach(n)
+		t.motState = n.Device.Motion
+	}
+
+	n.Device.Thermostat = t.state
+	n.OnSettings = func(settings refuge.Settings) {
+		fmt.Printf("(%s) Got new settings request: %#v\n", time.Now().Format("15:04:05 MST"), settings)
+		t.apply(settings)
+		// Hand made changes hold until the next schedule block starts.
+		t.state.Override = t.state.Block != nil
+		t.requested = true
+	}
+	n.OnSchedule = func(s refuge.Schedule) {
+		fmt.Printf("(%s) Got new schedule with %d blocks\n", time.Now().Format("15:04:05 MST"), len(s.Blocks))
+		t.SetSchedule(s)
+		t.runControl = true
+		t.requested = true
+	}
+	n.OnOccupancy = func(o refuge.Occupancy) {
+		t.remoteAt = time.Now()
+		if o.Motion != t.remoteMotion.Unix() {
+			t.remoteMotion = time.Unix(o.Motion, 0)
+			t.runControl = true
+		}
+	}
+	n.OnRemoteTemp = func(rt refuge.RemoteTemp) {
+		if t.remote.update(rt, time.Now()) {
+			t.runControl = true
+		}
+	}
+	n.OnSetback = func(sb refuge.Setback) {
+		fmt.Printf("(%s) Got new setback policy: %#v\n", time.Now().Format("15:04:05 MST"), sb)
+		t.state.Setback = sb
+		t.runControl = true
+		t.requested = true
+		t.dirty = true
+	}
+}
+
+// apply changes the settings, keeping the current mode if none is set.
+func (t *Thermostat) apply(settings refuge.Settings) {
+	t.state.Settings.High = settings.High
+	t.state.Settings.Low = settings.Low
+	if settings.Mode != refuge.ModeUnset {
+		t.state.Settings.Mode = settings.Mode
+	}
+	t.runControl = true
+	t.dirty = true
+}
+
+// save writes the settings to the state file if they changed.
+// Failures are retried on the next change, the thermostat keeps running on what it has in memory.
+func (t *Thermostat) save() {
+	if !t.dirty || t.stateFile == "" {
+		return
+	}
+	t.dirty = false
+	err := saveState(t.stateFile, thermostatState{
+		Settings: t.state.Settings,
+		Schedule: t.schedule,
+		Block:    t.state.Block,
+		Override: t.state.Override,
+		Setback:  &t.state.Setback,
+	})
+	if err != nil {
+		fmt.Printf("Failed to save thermostat state to %s: %s\n", t.stateFile, err)
+	}
+}
+
+// followSchedule applies the settings of the active schedule block when a new one starts.
+func (t *Thermostat) followSchedule(now time.Time) {
+	b, ok := climate.ActiveBlock(t.schedule, now)
+	if !ok {
+		if t.state.Block != nil {
+			t.state.Block = nil
+			t.state.Override = false
+			t.runControl = true // Nothing to change but let everyone know the schedule is gone.
+		}
+		return
+	}
+	if t.state.Block != nil && *t.state.Block == b {
+		return
+	}
+	fmt.Printf("(%s) Starting schedule block: %#v\n", now.Format("15:04:05 MST"), b)
+	t.apply(b.Settings)
+	t.state.Block = &b
+	t.state.Override = false
+}
+
+// Tick implements Capability.
+// Sensors are re-read every interval of the thermometer, or sooner when the motion state changes.
+func (t *Thermostat) Tick(now time.Time) bool {
+	changed := false
+	t.followSchedule(now)
+	t.save()
+	temp, humi, remote := t.remote.reading(now)
+	readAt := now
+	if !remote {
+		readAt = t.therm.LastGood()
+	}
+	if climate.Failsafe(t.cl, readAt, now) {
+		// Control starts again with the next good reading.
+		if t.state.Fault != t.cl.Fault() {
+			t.state.State, t.state.Target, t.state.Fault = t.cl.State(), -1, t.cl.Fault()
+			t.state.Stage, t.state.Aux = 0, false
+			fmt.Printf("(%s) Broadcasting failsafe state: %#v\n", now.Format("15:04:05 MST"), t.state)
+			changed = true
+		}
+	} else if t.runControl && (remote || t.therm.hasReading()) {
+		fmt.Printf("(%s) Starting control loop...", now.Format("15:04:05 MST"))
+		if !remote {
+			temp, humi = t.therm.Reading()
+		}
+		lastMotion := t.lastMotion(now)
+		t.state.Target = climate.Control(t.cl, t.state.Settings, t.state.Setback, lastMotion, sensor.ThermalReading{Temp: temp, Humi: humi, Time: now})
+		t.state.State, t.state.Fault = t.cl.State(), t.cl.Fault()
+		t.state.Away = climate.Away(t.state.Setback, lastMotion, now)
+		stage, aux := t.cl.Staging()
+		t.state.Stage, t.state.Aux = byte(stage), aux
+		t.state.Temp, t.state.Remote = temp, remote
+		t.therm.publish()
+		if t.motState != nil {
+			t.motState.Motion = t.motion.LastMotion().Unix()
+		}
+		fmt.Printf("(%s) Broadcasting new state: %#v %#v\n", now.Format("15:04:05 MST"), t.thermState, t.state)
+		t.runControl = false
+		changed = true
+	}
+	if t.requested {
+		// Return right away so the ack with the resulting state isn't held up by reading sensors.
+		t.requested = false
+		return changed
+	}
+
+	if t.motion != nil && t.motion.Tick(now) {
+		t.runControl = true
+	}
+	if t.therm.update(now, t.runControl) {
+		t.runControl = true
+	}
+	return changed
+}
+
+// Close stops watching the motion sensor.
+func (t *Thermostat) Close() error {
+	if t.motion != nil {
+		return t.motion.Close()
+	}
+	return nil
+}
+
+// lastMotion returns when motion was last seen by the thermostat's own sensor or, if it uses them, the room/house sensors.
+func (t *Thermostat) lastMotion(now time.Time) time.Time {
+	last := now // Always occupied without anything to go on.
+	if t.motion != nil {
+		last = t.motion.LastMotion()
+	}
+	if t.state.Occupancy == refuge.OccupancyLocal || now.Sub(t.remoteAt) > occupancyTimeout {
+		return last
+	}
+	if t.motion == nil || t.remoteMotion.After(last) {
+		last = t.remoteMotion
+	}
+	return last
+}
@@ -0,0 +1,263 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// This file talks to the linux gpiochip character device using the v1 line handle/event ioctls.
+// See include/uapi/linux/gpio.h in the kernel source.
+
+const defaultChip = "/dev/gpiochip0"
+
+const (
+	handlesMax = 64
+
+	handleRequestInput    = 1 << 0
+	handleRequestOutput   = 1 << 1
+	handleRequestPullUp   = 1 << 5
+	handleRequestPullDown = 1 << 6
+	handleRequestNoBias   = 1 << 7
+
+	eventRequestRising  = 1 << 0
+	eventRequestFalling = 1 << 1
+)
+
+// gpiohandle_request
+type handleRequest struct {
+	lineOffsets   [handlesMax]uint32
+	flags         uint32
+	defaultValues [handlesMax]uint8
+	consumer      [32]byte
+	lines         uint32
+	fd            int32
+}
+
+// gpioevent_request
+type eventRequest struct {
+	lineOffset  uint32
+	handleFlags uint32
+	eventFlags  uint32
+	consumer    [32]byte
+	fd          int32
+}
+
+// gpiohandle_data
+type handleData struct {
+	values [handlesMax]uint8
+}
+
+// gpioevent_data
+type eventData struct {
+	timestamp uint64
+	id        uint32
+	_         uint32
+}
+
+func iowr(nr, size uintptr) uintptr {
+	return 3<<30 | size<<16 | 0xB4<<8 | nr
+}
+
+var (
+	getLineHandle = iowr(0x03, unsafe.Sizeof(handleRequest{}))
+	getLineEvent  = iowr(0x04, unsafe.Sizeof(eventRequest{}))
+	getLineValues = iowr(0x08, unsafe.Sizeof(handleData{}))
+	setLineValues = iowr(0x09, unsafe.Sizeof(handleData{}))
+)
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// chipBoard is a linux gpiochip character device. Pins are the line offsets of the chip,
+// which are the BCM gpio numbers on a raspberry pi.
+type chipBoard struct {
+	fd   int
+	lock sync.Mutex
+	pins map[int]*chipPin
+}
+
+// OpenChip opens the gpiochip character device at the path, like /dev/gpiochip0.
+func OpenChip(path string) (Board, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	return &chipBoard{fd: fd, pins: map[int]*chipPin{}}, nil
+}
+
+func (cb *chipBoard) Pin(n int) Pin {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	p, ok := cb.pins[n]
+	if !ok {
+		p = &chipPin{chip: cb, offset: uint32(n), fd: -1}
+		cb.pins[n] = p
+	}
+	return p
+}
+
+func (cb *chipBoard) Close() error {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	for _, p := range cb.pins {
+		p.release()
+	}
+	return syscall.Close(cb.fd)
+}
+
+// chipPin is a single line of the chip.
+// The line is requested again every time its direction, pull or edge detection changes, setting them to what
+// they already are does nothing so it doesn't glitch the line.
+type chipPin struct {
+	chip   *chipBoard
+	offset uint32
+	fd     int // line handle, or line event fd while detecting edges. -1 if not requested.
+
+	output bool
+	high   bool // level driven while an output
+	pull   Pull
+	edge   Edge
+}
+
+func (p *chipPin) Input() {
+	if p.fd >= 0 && !p.output {
+		return
+	}
+	p.output = false
+	p.request()
+}
+
+func (p *chipPin) Output() {
+	if p.fd >= 0 && p.output {
+		return
+	}
+	p.output = true
+	p.request()
+}
+
+func (p *chipPin) High() { p.write(true) }
+func (p *chipPin) Low()  { p.write(false) }
+
+func (p *chipPin) Read() bool {
+	if p.fd < 0 {
+		p.request()
+	}
+	data := handleData{}
+	if err := ioctl(p.fd, getLineValues, unsafe.Pointer(&data)); err != nil {
+		fmt.Printf("Failed to read gpio line %d: %v\n", p.offset, err)
+		return false
+	}
+	return data.values[0] == 1
+}
+
+func (p *chipPin) Pull(pull Pull) {
+	if p.fd >= 0 && p.pull == pull {
+		return
+	}
+	p.pull = pull
+	if !p.output {
+		p.request()
+	}
+}
+
+func (p *chipPin) Detect(e Edge) {
+	if p.fd >= 0 && p.edge == e {
+		return
+	}
+	p.edge = e
+	p.request()
+}
+
+func (p *chipPin) EdgeDetected() bool {
+	if p.edge == NoEdge || p.output || p.fd < 0 {
+		return false
+	}
+	detected := false
+	ev := eventData{}
+	buf := (*[unsafe.Sizeof(eventData{})]byte)(unsafe.Pointer(&ev))[:]
+	for {
+		n, err := syscall.Read(p.fd, buf)
+		if err != nil || n < len(buf) {
+			return detected // EAGAIN, no more events queued.
+		}
+		detected = true
+	}
+}
+
+func (p *chipPin) write(high bool) {
+	p.high = high
+	if !p.output || p.fd < 0 {
+		return // Driven once the pin is an output.
+	}
+	data := handleData{}
+	if high {
+		data.values[0] = 1
+	}
+	if err := ioctl(p.fd, setLineValues, unsafe.Pointer(&data)); err != nil {
+		fmt.Printf("Failed to write gpio line %d: %v\n", p.offset, err)
+	}
+}
+
+// request releases the line and requests it again with the current settings.
+func (p *chipPin) request() {
+	p.release()
+
+	flags := uint32(handleRequestInput)
+	if p.output {
+		flags = handleRequestOutput
+	} else {
+		switch p.pull {
+		case PullUp:
+			flags |= handleRequestPullUp
+		case PullDown:
+			flags |= handleRequestPullDown
+		default:
+			flags |= handleRequestNoBias
+		}
+	}
+
+	if p.edge != NoEdge && !p.output {
+		req := eventRequest{lineOffset: p.offset, handleFlags: flags}
+		switch p.edge {
+		case RiseEdge:
+			req.eventFlags = eventRequestRising
+		case FallEdge:
+			req.eventFlags = eventRequestFalling
+		default:
+			req.eventFlags = eventRequestRising | eventRequestFalling
+		}
+		copy(req.consumer[:], "refuge")
+		if err := ioctl(p.chip.fd, getLineEvent, unsafe.Pointer(&req)); err != nil {
+			fmt.Printf("Failed to request events for gpio line %d: %v\n", p.offset, err)
+			return
+		}
+		p.fd = int(req.fd)
+		syscall.SetNonblock(p.fd, true)
+		return
+	}
+
+	req := handleRequest{flags: flags, lines: 1}
+	req.lineOffsets[0] = p.offset
+	if p.high {
+		req.defaultValues[0] = 1
+	}
+	copy(req.consumer[:], "refuge")
+	if err := ioctl(p.chip.fd, getLineHandle, unsafe.Pointer(&req)); err != nil {
+		fmt.Printf("Failed to request gpio line %d: %v\n", p.offset, err)
+		return
+	}
+	p.fd = int(req.fd)
+}
+
+func (p *chipPin) release() {
+	if p.fd >= 0 {
+		syscall.Close(p.fd)
+		p.fd = -1
+	}
+}
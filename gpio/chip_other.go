@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package gpio
+
+import "errors"
+
+const defaultChip = "/dev/gpiochip0"
+
+// OpenChip is only supported on linux.
+func OpenChip(path string) (Board, error) {
+	return nil, errors.New("gpiochip character devices are only supported on linux")
+}
@@ -0,0 +1,151 @@
+package gpio
+
+import "sync"
+
+// Fake is an in-memory board for running without hardware and for tests.
+// Tests drive inputs with FakePin.Set and check outputs with FakePin.Level,
+// or script the pins with the OnWrite/OnRead hooks.
+type Fake struct {
+	lock sync.Mutex
+	pins map[int]*FakePin
+}
+
+// NewFake creates a board of fake pins.
+func NewFake() *Fake {
+	return &Fake{pins: map[int]*FakePin{}}
+}
+
+// Pin implements Board.
+func (f *Fake) Pin(n int) Pin {
+	return f.FakePin(n)
+}
+
+// FakePin returns the numbered pin, so tests can drive and inspect it.
+func (f *Fake) FakePin(n int) *FakePin {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	p, ok := f.pins[n]
+	if !ok {
+		p = &FakePin{Num: n}
+		f.pins[n] = p
+	}
+	return p
+}
+
+// Close implements Board.
+func (f *Fake) Close() error { return nil }
+
+// FakePin is an in-memory pin.
+type FakePin struct {
+	Num int
+
+	// OnWrite is called whenever the device drives the pin high or low.
+	OnWrite func(high bool)
+	// OnRead, if set, supplies the level for every read instead of the pin level.
+	OnRead func() bool
+
+	lock     sync.Mutex
+	output   bool
+	level    bool
+	driven   bool // set once something external drove the level, pulls no longer change it.
+	pull     Pull
+	edge     Edge
+	detected bool
+}
+
+// Set drives the level of the pin from outside, like a sensor would.
+func (p *FakePin) Set(high bool) {
+	p.lock.Lock()
+	p.driven = true
+	p.setLevel(high)
+	p.lock.Unlock()
+}
+
+// Level returns the current level of the pin.
+func (p *FakePin) Level() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.level
+}
+
+// IsOutput returns true if the pin is in output mode.
+func (p *FakePin) IsOutput() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.output
+}
+
+// Pulled returns the pull resistor setting of the pin.
+func (p *FakePin) Pulled() Pull {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.pull
+}
+
+func (p *FakePin) Input() {
+	p.lock.Lock()
+	p.output = false
+	p.lock.Unlock()
+}
+
+func (p *FakePin) Output() {
+	p.lock.Lock()
+	p.output = true
+	p.lock.Unlock()
+}
+
+func (p *FakePin) High() { p.write(true) }
+func (p *FakePin) Low()  { p.write(false) }
+
+func (p *FakePin) Read() bool {
+	if p.OnRead != nil {
+		return p.OnRead()
+	}
+	return p.Level()
+}
+
+func (p *FakePin) Pull(pull Pull) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pull = pull
+	if !p.driven && !p.output && pull != PullOff {
+		p.setLevel(pull == PullUp)
+	}
+}
+
+func (p *FakePin) Detect(e Edge) {
+	p.lock.Lock()
+	p.edge = e
+	p.detected = false
+	p.lock.Unlock()
+}
+
+func (p *FakePin) EdgeDetected() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	d := p.detected
+	p.detected = false
+	return d
+}
+
+func (p *FakePin) write(high bool) {
+	p.lock.Lock()
+	p.setLevel(high)
+	p.lock.Unlock()
+	if p.OnWrite != nil {
+		p.OnWrite(high)
+	}
+}
+
+// setLevel changes the level and records any edge being detected. Must hold the lock.
+func (p *FakePin) setLevel(high bool) {
+	if high != p.level {
+		switch {
+		case p.edge == AnyEdge,
+			p.edge == RiseEdge && high,
+			p.edge == FallEdge && !high:
+			p.detected = true
+		}
+	}
+	p.level = high
+}
@@ -0,0 +1,93 @@
+package gpio
+
+import "testing"
+
+func TestFakePinLevels(t *testing.T) {
+	f := NewFake()
+	p := f.FakePin(4)
+	if f.Pin(4) != Pin(p) {
+		t.Fatal("Pin and FakePin returned different pins")
+	}
+
+	p.Output()
+	p.High()
+	if !p.IsOutput() || !p.Level() || !p.Read() {
+		t.Fatal("output driven high doesn't read high")
+	}
+	p.Low()
+	if p.Level() || p.Read() {
+		t.Fatal("output driven low doesn't read low")
+	}
+
+	var writes []bool
+	p.OnWrite = func(high bool) { writes = append(writes, high) }
+	p.High()
+	p.Low()
+	if len(writes) != 2 || !writes[0] || writes[1] {
+		t.Fatalf("OnWrite got %v, want [true false]", writes)
+	}
+
+	p.OnRead = func() bool { return true }
+	if !p.Read() || p.Level() {
+		t.Fatal("OnRead doesn't replace the level for reads")
+	}
+}
+
+func TestFakePinPull(t *testing.T) {
+	p := NewFake().FakePin(17)
+	p.Input()
+	p.Pull(PullUp)
+	if !p.Read() || p.Pulled() != PullUp {
+		t.Fatal("floating input pulled up doesn't read high")
+	}
+	p.Pull(PullDown)
+	if p.Read() {
+		t.Fatal("floating input pulled down doesn't read low")
+	}
+
+	// Once something drives the pin, the pull no longer changes it.
+	p.Set(true)
+	p.Pull(PullDown)
+	if !p.Read() {
+		t.Fatal("pull changed the level of a driven input")
+	}
+}
+
+func TestFakePinEdges(t *testing.T) {
+	tests := []struct {
+		edge   Edge
+		levels []bool // Levels the pin is set to after starting low.
+		want   bool
+	}{
+		{NoEdge, []bool{true}, false},
+		{AnyEdge, []bool{true}, true},
+		{AnyEdge, []bool{false}, false},
+		{RiseEdge, []bool{true}, true},
+		{RiseEdge, []bool{true, false}, true}, // Latched, even though the pin is low again.
+		{FallEdge, []bool{true}, false},
+		{FallEdge, []bool{true, false}, true},
+	}
+	for _, tt := range tests {
+		p := NewFake().FakePin(22)
+		p.Input()
+		p.Detect(tt.edge)
+		for _, l := range tt.levels {
+			p.Set(l)
+		}
+		if got := p.EdgeDetected(); got != tt.want {
+			t.Errorf("edge %v after %v: got %v, want %v", tt.edge, tt.levels, got, tt.want)
+		}
+		if p.EdgeDetected() {
+			t.Errorf("edge %v after %v: still detected after it was read", tt.edge, tt.levels)
+		}
+	}
+
+	// Changing the detection drops any edge latched before it.
+	p := NewFake().FakePin(23)
+	p.Detect(AnyEdge)
+	p.Set(true)
+	p.Detect(AnyEdge)
+	if p.EdgeDetected() {
+		t.Error("edge from before Detect was still latched")
+	}
+}
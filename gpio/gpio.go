@@ -0,0 +1,99 @@
+// Package gpio is a small abstraction over digital gpio pins.
+// It lets the device logic run on the raspberry pi memory mapped registers (rpio),
+// the linux gpiochip character device or an in-memory fake for running and testing without hardware.
+package gpio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pull is the pull resistor setting of an input pin.
+type Pull uint8
+
+// Pull resistor settings
+const (
+	PullOff Pull = iota
+	PullDown
+	PullUp
+)
+
+// Edge is the kind of level change to detect on an input pin.
+type Edge uint8
+
+// Edges to detect
+const (
+	NoEdge   Edge = iota
+	RiseEdge      // low to high
+	FallEdge      // high to low
+	AnyEdge
+)
+
+// Pin is a single digital gpio pin.
+type Pin interface {
+	Input()
+	Output()
+	High()
+	Low()
+	Read() bool // true if the pin is high
+	Pull(p Pull)
+	// Detect starts detecting the given edge, NoEdge stops it.
+	Detect(e Edge)
+	// EdgeDetected returns true if the edge was seen since the last call.
+	EdgeDetected() bool
+}
+
+// Board hands out the pins of a gpio backend.
+type Board interface {
+	Pin(n int) Pin
+	Close() error
+}
+
+// Open opens the named gpio backend:
+//
+//	rpio             raspberry pi memory mapped registers
+//	chip             linux gpiochip character device /dev/gpiochip0
+//	/dev/gpiochipN   a specific linux gpiochip character device
+//	fake             in-memory pins
+//	auto             rpio, falling back to /dev/gpiochip0
+func Open(backend string) (Board, error) {
+	switch {
+	case backend == "rpio":
+		return OpenRPIO()
+	case backend == "chip":
+		return OpenChip(defaultChip)
+	case strings.HasPrefix(backend, "/dev/"):
+		return OpenChip(backend)
+	case backend == "fake":
+		return NewFake(), nil
+	case backend == "auto" || backend == "":
+		b, err := OpenRPIO()
+		if err == nil {
+			return b, nil
+		}
+		b, cerr := OpenChip(defaultChip)
+		if cerr == nil {
+			return b, nil
+		}
+		return nil, fmt.Errorf("%v, %v", err, cerr)
+	}
+	return nil, fmt.Errorf("unknown gpio backend %q", backend)
+}
+
+// OpenOrFake opens the named backend, falling back to an in-memory fake if it can't be opened.
+func OpenOrFake(backend string) Board {
+	b, err := Open(backend)
+	if err != nil {
+		fmt.Printf("Unable to open gpio pins: %s\n-----  Defaulting to use fake pins.  -----\n", err)
+		return NewFake()
+	}
+	return b
+}
+
+// Optional returns the numbered pin of the board, nil if n is 0 (not connected).
+func Optional(b Board, n int) Pin {
+	if n == 0 {
+		return nil
+	}
+	return b.Pin(n)
+}
@@ -0,0 +1,52 @@
+package gpio
+
+import (
+	rpio "github.com/stianeikeland/go-rpio"
+)
+
+// rpioBoard uses the raspberry pi gpio registers through /dev/gpiomem or /dev/mem.
+type rpioBoard struct{}
+
+// OpenRPIO memory maps the raspberry pi gpio registers.
+func OpenRPIO() (Board, error) {
+	if err := rpio.Open(); err != nil {
+		return nil, err
+	}
+	return rpioBoard{}, nil
+}
+
+func (rpioBoard) Pin(n int) Pin { return rpioPin(n) }
+func (rpioBoard) Close() error  { return rpio.Close() }
+
+type rpioPin rpio.Pin
+
+func (p rpioPin) Input()             { rpio.Pin(p).Input() }
+func (p rpioPin) Output()            { rpio.Pin(p).Output() }
+func (p rpioPin) High()              { rpio.Pin(p).High() }
+func (p rpioPin) Low()               { rpio.Pin(p).Low() }
+func (p rpioPin) Read() bool         { return rpio.Pin(p).Read() == rpio.High }
+func (p rpioPin) EdgeDetected() bool { return rpio.Pin(p).EdgeDetected() }
+
+func (p rpioPin) Pull(pull Pull) {
+	switch pull {
+	case PullDown:
+		rpio.Pin(p).PullDown()
+	case PullUp:
+		rpio.Pin(p).PullUp()
+	default:
+		rpio.Pin(p).PullOff()
+	}
+}
+
+func (p rpioPin) Detect(e Edge) {
+	switch e {
+	case RiseEdge:
+		rpio.Pin(p).Detect(rpio.RiseEdge)
+	case FallEdge:
+		rpio.Pin(p).Detect(rpio.FallEdge)
+	case AnyEdge:
+		rpio.Pin(p).Detect(rpio.AnyEdge)
+	default:
+		rpio.Pin(p).Detect(rpio.NoEdge)
+	}
+}
@@ -2,10 +2,11 @@ package refuge
 
 // Portal represents any door/window that can be monitored or open/closed
 type Portal struct {
-	State PortalState // Can signal current state or intended state. Unknown, Closed, Open
+	State PortalState // Can signal current state or intended state. Only Closed and Open can be requested.
+	Lock  LockState   // Can signal current lock state or intended lock state. Unknown, Unlocked, Locked
 }
 
-// PortalState is the state of the portal (open/closed)
+// PortalState is the state of the portal (open/closed/moving)
 type PortalState uint64
 
 // Enum of portal states
@@ -13,14 +14,47 @@ const (
 	PortalStateUnknown PortalState = iota
 	PortalStateClosed
 	PortalStateOpen
+	PortalStateOpening
+	PortalStateClosing
+	PortalStateStopped    // Stopped somewhere between open and closed
+	PortalStateObstructed // Failed to reach the requested state in time
 )
 
 func (ps PortalState) String() string {
-	if ps == PortalStateOpen {
+	switch ps {
+	case PortalStateOpen:
 		return "open"
-	}
-	if ps == PortalStateClosed {
+	case PortalStateClosed:
 		return "closed"
+	case PortalStateOpening:
+		return "opening"
+	case PortalStateClosing:
+		return "closing"
+	case PortalStateStopped:
+		return "stopped"
+	case PortalStateObstructed:
+		return "obstructed"
+	}
+	return "unknown"
+}
+
+// LockState is the lock state of the portal (locked/unlocked).
+// Portals without a lock will always be LockStateUnknown.
+type LockState uint64
+
+// Enum of lock states
+const (
+	LockStateUnknown LockState = iota
+	LockStateUnlocked
+	LockStateLocked
+)
+
+func (ls LockState) String() string {
+	if ls == LockStateLocked {
+		return "locked"
+	}
+	if ls == LockStateUnlocked {
+		return "unlocked"
 	}
 	return "unknown"
 }
@@ -32,19 +66,105 @@ type Thermostat struct {
 	State    ControlState // Active or Not
 	Target   float32      // Target for heating/cooling
 	Settings Settings
+	Stage    byte // Stage of heating/cooling running, 0 when idle
+	Aux      bool // Aux heat is on
+
+	Block    *ScheduleBlock // Active schedule block, nil if there is no schedule
+	Override bool           // Settings were changed by hand and hold until the next block starts
+
+	Setback   Setback         // Away setback policy
+	Away      bool            // No motion has been seen for a while and the setback is active
+	Occupancy OccupancySource // Which motion sensors the setback goes by
+
+	Sources []TempSource // Remote thermometers controlled on instead of its own, if any
+	Temp    float32      // Temp the thermostat is controlling on
+	Remote  bool         // Temp is from the remote sources, false while using its own thermometer
+
+	Fault Fault // Why the thermostat is in its failsafe, FaultNone while running normally
+}
+
+// Fault is a problem that put a thermostat in its failsafe.
+type Fault byte
+
+// Enum of thermostat faults
+const (
+	FaultNone     Fault = iota
+	FaultStale          // No good temp readings for too long, heating/cooling is off
+	FaultFreeze         // Temp is below the freeze limit, heating regardless of settings
+	FaultOverTemp       // Temp is above the over temp limit, heating is off
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FaultNone:
+		return "none"
+	case FaultStale:
+		return "no recent temp readings"
+	case FaultFreeze:
+		return "below freeze limit"
+	case FaultOverTemp:
+		return "above over temp limit"
+	}
+	return "unknown"
 }
 
 // Thermometer is a thermometer reading.
+// Temp and Humidity are calibrated and filtered, RawTemp and RawHumidity are straight from the sensor.
 type Thermometer struct {
-	Temp     float32 // Last temp reading
-	Humidity float32 // Last humidity reading
+	Temp        float32 // Last temp reading
+	Humidity    float32 // Last humidity reading
+	Pressure    float32 // Last pressure reading (hPa), 0 if the sensor can't measure it
+	RawTemp     float32
+	RawHumidity float32
+	Calibration Calibration
+	Filter      string // Smoothing filter applied after calibration, see sensor.ParseFilter
+}
+
+// Calibration corrects the raw readings of a thermometer: raw*Scale + Offset.
+// A scale of 0 is treated as 1.
+type Calibration struct {
+	TempOffset float32
+	TempScale  float32
+	HumiOffset float32
+	HumiScale  float32
 }
 
 // Motion is a motion sensor reading
 type Motion struct {
 	Motion int64 // Last motion event
+	Active bool  // Motion is still going on, Motion is when it started
+}
+
+// TempSource is a remote thermometer a thermostat can control on.
+// The server sends the thermostat the readings of its sources.
+type TempSource struct {
+	ID     string  // Device ID of the thermometer, empty to use Room instead
+	Room   string  // Room ID, every thermometer placed in the room is averaged
+	Weight float32 // Weight in the average of all sources, 0 counts as 1
+}
+
+// RemoteTemp is the reading of a TempSource, sent by the server to the thermostat using it.
+type RemoteTemp struct {
+	Source   TempSource
+	Temp     float32
+	Humidity float32
+	Age      uint32 // Seconds since the server last heard from the thermometer
+}
+
+// Occupancy is sent by the server to thermostats that go by the motion sensors in their room or the whole house.
+type Occupancy struct {
+	Motion int64 // Last motion event from any motion sensor in the room/house
 }
 
+// OccupancySource is where a thermostat gets motion from.
+type OccupancySource byte
+
+const (
+	OccupancyLocal OccupancySource = iota // Only its own motion sensor
+	OccupancyRoom                         // Every motion sensor in the same room, from the server
+	OccupancyHouse                        // Every motion sensor in the house, from the server
+)
+
 // Switch represents any devices that can be switched on/off
 // Examples: Lights, Gas Fireplace, etc
 type Switch struct {
@@ -72,6 +192,14 @@ type Settings struct {
 	Mode Mode
 }
 
+// Setback widens the temp range while nobody is home, so the house isn't heated/cooled for no one.
+type Setback struct {
+	Enabled     bool
+	AwayMinutes uint16  // Minutes without motion before the house is considered empty
+	Heat        float32 // How far (C) to lower the low temp when away
+	Cool        float32 // How far (C) to raise the high temp when away
+}
+
 type ControlState byte
 
 const (
@@ -86,6 +214,7 @@ type Mode byte
 const (
 	ModeUnset Mode = iota
 	ModeOff
-	ModeAuto // Manage temp range
-	ModeFan  // Just run fan
+	ModeAuto          // Manage temp range
+	ModeFan           // Just run fan
+	ModeEmergencyHeat // Only heat, with just the aux heat
 )
@@ -1,10 +1,9 @@
-// Code generated by netgen tool on Oct 2 2019 22:02 MDT. DO NOT EDIT
+// Code generated by netgen tool on Oct 18 2026 03:33 MDT. DO NOT EDIT
 package refuge
 
 import (
-	"time"
-
 	"github.com/lologarithm/netgen/lib/ngen"
+	"time"
 )
 
 var Context = &ngen.Context{
@@ -13,14 +12,21 @@ var Context = &ngen.Context{
 }
 
 const (
-	PortalMsgType      = 201496262
-	ThermostatMsgType  = 4190559744
-	ThermometerMsgType = 313615057
-	MotionMsgType      = 4065502430
-	SwitchMsgType      = 1749372462
-	DeviceMsgType      = 243512248
-	SettingsMsgType    = 473154195
-	TempEventMsgType   = 2360498257
+	PortalMsgType        = 201496262
+	ThermostatMsgType    = 4190559744
+	ThermometerMsgType   = 313615057
+	CalibrationMsgType   = 2052996036
+	MotionMsgType        = 4065502430
+	TempSourceMsgType    = 199439368
+	RemoteTempMsgType    = 902508940
+	OccupancyMsgType     = 134206037
+	SwitchMsgType        = 1749372462
+	DeviceMsgType        = 243512248
+	SettingsMsgType      = 473154195
+	SetbackMsgType       = 2544954009
+	ScheduleMsgType      = 2739827629
+	ScheduleBlockMsgType = 1288283027
+	TempEventMsgType     = 2360498257
 )
 
 // Read accepts input of raw bytes and a type. Parses and returns a message.
@@ -37,9 +43,21 @@ func Read(ctx *ngen.Context, msgType ngen.MessageType, content *ngen.Buffer) nge
 	case ThermometerMsgType:
 		msg := DeserializeThermometer(ctx, content)
 		return &msg
+	case CalibrationMsgType:
+		msg := DeserializeCalibration(ctx, content)
+		return &msg
 	case MotionMsgType:
 		msg := DeserializeMotion(ctx, content)
 		return &msg
+	case TempSourceMsgType:
+		msg := DeserializeTempSource(ctx, content)
+		return &msg
+	case RemoteTempMsgType:
+		msg := DeserializeRemoteTemp(ctx, content)
+		return &msg
+	case OccupancyMsgType:
+		msg := DeserializeOccupancy(ctx, content)
+		return &msg
 	case SwitchMsgType:
 		msg := DeserializeSwitch(ctx, content)
 		return &msg
@@ -49,6 +67,15 @@ func Read(ctx *ngen.Context, msgType ngen.MessageType, content *ngen.Buffer) nge
 	case SettingsMsgType:
 		msg := DeserializeSettings(ctx, content)
 		return &msg
+	case SetbackMsgType:
+		msg := DeserializeSetback(ctx, content)
+		return &msg
+	case ScheduleMsgType:
+		msg := DeserializeSchedule(ctx, content)
+		return &msg
+	case ScheduleBlockMsgType:
+		msg := DeserializeScheduleBlock(ctx, content)
+		return &msg
 	case TempEventMsgType:
 		msg := DeserializeTempEvent(ctx, content)
 		return &msg
@@ -61,6 +88,8 @@ func Read(ctx *ngen.Context, msgType ngen.MessageType, content *ngen.Buffer) nge
 func DeserializePortal(ctx *ngen.Context, buffer *ngen.Buffer) (m Portal) {
 	tmpState := buffer.ReadUint32()
 	m.State = PortalState(tmpState)
+	tmpLock := buffer.ReadUint32()
+	m.Lock = LockState(tmpLock)
 	return m
 }
 
@@ -69,16 +98,70 @@ func DeserializeThermostat(ctx *ngen.Context, buffer *ngen.Buffer) (m Thermostat
 	m.State = ControlState(tmpState)
 	m.Target = buffer.ReadFloat32()
 	m.Settings = DeserializeSettings(ctx, buffer)
+	m.Stage = buffer.ReadByte()
+	m.Aux = buffer.ReadBool()
+	if v := buffer.ReadByte(); v == 1 {
+		var subBlock = DeserializeScheduleBlock(ctx, buffer)
+		m.Block = &subBlock
+	}
+	m.Override = buffer.ReadBool()
+	m.Setback = DeserializeSetback(ctx, buffer)
+	m.Away = buffer.ReadBool()
+	tmpOccupancy := buffer.ReadUint32()
+	m.Occupancy = OccupancySource(tmpOccupancy)
+	l10_1 := buffer.ReadUint32()
+	m.Sources = make([]TempSource, l10_1)
+	for i := uint32(0); i < l10_1; i++ {
+		m.Sources[i] = DeserializeTempSource(ctx, buffer)
+	}
+	m.Temp = buffer.ReadFloat32()
+	m.Remote = buffer.ReadBool()
+	tmpFault := buffer.ReadUint32()
+	m.Fault = Fault(tmpFault)
 	return m
 }
 
 func DeserializeThermometer(ctx *ngen.Context, buffer *ngen.Buffer) (m Thermometer) {
 	m.Temp = buffer.ReadFloat32()
 	m.Humidity = buffer.ReadFloat32()
+	m.Pressure = buffer.ReadFloat32()
+	m.RawTemp = buffer.ReadFloat32()
+	m.RawHumidity = buffer.ReadFloat32()
+	m.Calibration = DeserializeCalibration(ctx, buffer)
+	m.Filter = buffer.ReadString()
+	return m
+}
+
+func DeserializeCalibration(ctx *ngen.Context, buffer *ngen.Buffer) (m Calibration) {
+	m.TempOffset = buffer.ReadFloat32()
+	m.TempScale = buffer.ReadFloat32()
+	m.HumiOffset = buffer.ReadFloat32()
+	m.HumiScale = buffer.ReadFloat32()
 	return m
 }
 
 func DeserializeMotion(ctx *ngen.Context, buffer *ngen.Buffer) (m Motion) {
+	m.Motion = buffer.ReadInt64()
+	m.Active = buffer.ReadBool()
+	return m
+}
+
+func DeserializeTempSource(ctx *ngen.Context, buffer *ngen.Buffer) (m TempSource) {
+	m.ID = buffer.ReadString()
+	m.Room = buffer.ReadString()
+	m.Weight = buffer.ReadFloat32()
+	return m
+}
+
+func DeserializeRemoteTemp(ctx *ngen.Context, buffer *ngen.Buffer) (m RemoteTemp) {
+	m.Source = DeserializeTempSource(ctx, buffer)
+	m.Temp = buffer.ReadFloat32()
+	m.Humidity = buffer.ReadFloat32()
+	m.Age = buffer.ReadUint32()
+	return m
+}
+
+func DeserializeOccupancy(ctx *ngen.Context, buffer *ngen.Buffer) (m Occupancy) {
 	m.Motion = buffer.ReadInt64()
 	return m
 }
@@ -123,7 +206,32 @@ func DeserializeSettings(ctx *ngen.Context, buffer *ngen.Buffer) (m Settings) {
 	return m
 }
 
+func DeserializeSetback(ctx *ngen.Context, buffer *ngen.Buffer) (m Setback) {
+	m.Enabled = buffer.ReadBool()
+	m.AwayMinutes = buffer.ReadUint16()
+	m.Heat = buffer.ReadFloat32()
+	m.Cool = buffer.ReadFloat32()
+	return m
+}
+
+func DeserializeSchedule(ctx *ngen.Context, buffer *ngen.Buffer) (m Schedule) {
+	l0_1 := buffer.ReadUint32()
+	m.Blocks = make([]ScheduleBlock, l0_1)
+	for i := uint32(0); i < l0_1; i++ {
+		m.Blocks[i] = DeserializeScheduleBlock(ctx, buffer)
+	}
+	return m
+}
+
+func DeserializeScheduleBlock(ctx *ngen.Context, buffer *ngen.Buffer) (m ScheduleBlock) {
+	m.Day = buffer.ReadByte()
+	m.Minute = buffer.ReadUint16()
+	m.Settings = DeserializeSettings(ctx, buffer)
+	return m
+}
+
 func DeserializeTempEvent(ctx *ngen.Context, buffer *ngen.Buffer) (m TempEvent) {
+	m.ID = buffer.ReadString()
 	m.Name = buffer.ReadString()
 	m.Time = time.Unix(int64(buffer.ReadUint64()), 0)
 	m.Temp = buffer.ReadFloat32()
@@ -1,10 +1,11 @@
-// Code generated by netgen tool on Oct 2 2019 22:02 MDT. DO NOT EDIT
+// Code generated by netgen tool on Oct 18 2026 03:33 MDT. DO NOT EDIT
 package refuge
 
 import "github.com/lologarithm/netgen/lib/ngen"
 
 func (m Portal) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 	buffer.WriteUint32(uint32(m.State))
+	buffer.WriteUint32(uint32(m.Lock))
 
 	return buffer.Err
 }
@@ -12,6 +13,7 @@ func (m Portal) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 func (m Portal) Length(ctx *ngen.Context) int {
 	mylen := 0
 	mylen += 4 // m.State, Type: PortalState
+	mylen += 4 // m.Lock, Type: LockState
 	return mylen
 }
 
@@ -23,6 +25,25 @@ func (m Thermostat) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 	buffer.WriteUint32(uint32(m.State))
 	buffer.WriteFloat32(m.Target)
 	m.Settings.Serialize(ctx, buffer)
+	buffer.WriteByte(m.Stage)
+	buffer.WriteBool(m.Aux)
+	if m.Block != nil {
+		buffer.WriteBool(true)
+		m.Block.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	buffer.WriteBool(m.Override)
+	m.Setback.Serialize(ctx, buffer)
+	buffer.WriteBool(m.Away)
+	buffer.WriteUint32(uint32(m.Occupancy))
+	buffer.WriteUint32(uint32(len(m.Sources)))
+	for _, v2 := range m.Sources {
+		v2.Serialize(ctx, buffer)
+	}
+	buffer.WriteFloat32(m.Temp)
+	buffer.WriteBool(m.Remote)
+	buffer.WriteUint32(uint32(m.Fault))
 
 	return buffer.Err
 }
@@ -32,6 +53,24 @@ func (m Thermostat) Length(ctx *ngen.Context) int {
 	mylen += 4                      // m.State, Type: ControlState
 	mylen += 4                      // m.Target, Type: float32
 	mylen += m.Settings.Length(ctx) // m.Settings, Type: Settings
+	mylen += 1                      // m.Stage, Type: byte
+	mylen += 1                      // m.Aux, Type: bool
+
+	mylen++ // nil check
+	if m.Block != nil {
+		mylen += m.Block.Length(ctx)
+	} // m.Block, Type: ScheduleBlock
+	mylen += 1                     // m.Override, Type: bool
+	mylen += m.Setback.Length(ctx) // m.Setback, Type: Setback
+	mylen += 1                     // m.Away, Type: bool
+	mylen += 4                     // m.Occupancy, Type: OccupancySource
+	mylen += 4
+	for _, v2 := range m.Sources {
+		mylen += v2.Length(ctx) // v2, Type: TempSource
+	}
+	mylen += 4 // m.Temp, Type: float32
+	mylen += 1 // m.Remote, Type: bool
+	mylen += 4 // m.Fault, Type: Fault
 	return mylen
 }
 
@@ -42,14 +81,24 @@ func (m Thermostat) MsgType() ngen.MessageType {
 func (m Thermometer) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 	buffer.WriteFloat32(m.Temp)
 	buffer.WriteFloat32(m.Humidity)
+	buffer.WriteFloat32(m.Pressure)
+	buffer.WriteFloat32(m.RawTemp)
+	buffer.WriteFloat32(m.RawHumidity)
+	m.Calibration.Serialize(ctx, buffer)
+	buffer.WriteString(m.Filter)
 
 	return buffer.Err
 }
 
 func (m Thermometer) Length(ctx *ngen.Context) int {
 	mylen := 0
-	mylen += 4 // m.Temp, Type: float32
-	mylen += 4 // m.Humidity, Type: float32
+	mylen += 4                         // m.Temp, Type: float32
+	mylen += 4                         // m.Humidity, Type: float32
+	mylen += 4                         // m.Pressure, Type: float32
+	mylen += 4                         // m.RawTemp, Type: float32
+	mylen += 4                         // m.RawHumidity, Type: float32
+	mylen += m.Calibration.Length(ctx) // m.Calibration, Type: Calibration
+	mylen += 4 + len(m.Filter)         // m.Filter, Type: string
 	return mylen
 }
 
@@ -57,8 +106,31 @@ func (m Thermometer) MsgType() ngen.MessageType {
 	return ThermometerMsgType
 }
 
+func (m Calibration) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteFloat32(m.TempOffset)
+	buffer.WriteFloat32(m.TempScale)
+	buffer.WriteFloat32(m.HumiOffset)
+	buffer.WriteFloat32(m.HumiScale)
+
+	return buffer.Err
+}
+
+func (m Calibration) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 4 // m.TempOffset, Type: float32
+	mylen += 4 // m.TempScale, Type: float32
+	mylen += 4 // m.HumiOffset, Type: float32
+	mylen += 4 // m.HumiScale, Type: float32
+	return mylen
+}
+
+func (m Calibration) MsgType() ngen.MessageType {
+	return CalibrationMsgType
+}
+
 func (m Motion) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 	buffer.WriteUint64(uint64(m.Motion))
+	buffer.WriteBool(m.Active)
 
 	return buffer.Err
 }
@@ -66,6 +138,7 @@ func (m Motion) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 func (m Motion) Length(ctx *ngen.Context) int {
 	mylen := 0
 	mylen += 8 // m.Motion, Type: int64
+	mylen += 1 // m.Active, Type: bool
 	return mylen
 }
 
@@ -73,6 +146,64 @@ func (m Motion) MsgType() ngen.MessageType {
 	return MotionMsgType
 }
 
+func (m TempSource) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteString(m.ID)
+	buffer.WriteString(m.Room)
+	buffer.WriteFloat32(m.Weight)
+
+	return buffer.Err
+}
+
+func (m TempSource) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 4 + len(m.ID)   // m.ID, Type: string
+	mylen += 4 + len(m.Room) // m.Room, Type: string
+	mylen += 4               // m.Weight, Type: float32
+	return mylen
+}
+
+func (m TempSource) MsgType() ngen.MessageType {
+	return TempSourceMsgType
+}
+
+func (m RemoteTemp) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	m.Source.Serialize(ctx, buffer)
+	buffer.WriteFloat32(m.Temp)
+	buffer.WriteFloat32(m.Humidity)
+	buffer.WriteUint32(uint32(m.Age))
+
+	return buffer.Err
+}
+
+func (m RemoteTemp) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += m.Source.Length(ctx) // m.Source, Type: TempSource
+	mylen += 4                    // m.Temp, Type: float32
+	mylen += 4                    // m.Humidity, Type: float32
+	mylen += 4                    // m.Age, Type: uint32
+	return mylen
+}
+
+func (m RemoteTemp) MsgType() ngen.MessageType {
+	return RemoteTempMsgType
+}
+
+func (m Occupancy) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteUint64(uint64(m.Motion))
+
+	return buffer.Err
+}
+
+func (m Occupancy) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 8 // m.Motion, Type: int64
+	return mylen
+}
+
+func (m Occupancy) MsgType() ngen.MessageType {
+	return OccupancyMsgType
+}
+
 func (m Switch) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 	buffer.WriteBool(m.On)
 
@@ -184,7 +315,72 @@ func (m Settings) MsgType() ngen.MessageType {
 	return SettingsMsgType
 }
 
+func (m Setback) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteBool(m.Enabled)
+	buffer.WriteUint16(uint16(m.AwayMinutes))
+	buffer.WriteFloat32(m.Heat)
+	buffer.WriteFloat32(m.Cool)
+
+	return buffer.Err
+}
+
+func (m Setback) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 1 // m.Enabled, Type: bool
+	mylen += 2 // m.AwayMinutes, Type: uint16
+	mylen += 4 // m.Heat, Type: float32
+	mylen += 4 // m.Cool, Type: float32
+	return mylen
+}
+
+func (m Setback) MsgType() ngen.MessageType {
+	return SetbackMsgType
+}
+
+func (m Schedule) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteUint32(uint32(len(m.Blocks)))
+	for _, v2 := range m.Blocks {
+		v2.Serialize(ctx, buffer)
+	}
+
+	return buffer.Err
+}
+
+func (m Schedule) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 4
+	for _, v2 := range m.Blocks {
+		mylen += v2.Length(ctx) // v2, Type: ScheduleBlock
+	}
+	return mylen
+}
+
+func (m Schedule) MsgType() ngen.MessageType {
+	return ScheduleMsgType
+}
+
+func (m ScheduleBlock) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteByte(m.Day)
+	buffer.WriteUint16(uint16(m.Minute))
+	m.Settings.Serialize(ctx, buffer)
+
+	return buffer.Err
+}
+
+func (m ScheduleBlock) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 1                      // m.Day, Type: byte
+	mylen += 2                      // m.Minute, Type: uint16
+	mylen += m.Settings.Length(ctx) // m.Settings, Type: Settings
+	return mylen
+}
+
+func (m ScheduleBlock) MsgType() ngen.MessageType {
+	return ScheduleBlockMsgType
+}
+
 func (m TempEvent) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteString(m.ID)
 	buffer.WriteString(m.Name)
 	buffer.WriteUint64(uint64(m.Time.Unix()))
 	buffer.WriteFloat32(m.Temp)
@@ -196,6 +392,7 @@ func (m TempEvent) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
 
 func (m TempEvent) Length(ctx *ngen.Context) int {
 	mylen := 0
+	mylen += 4 + len(m.ID)   // m.ID, Type: string
 	mylen += 4 + len(m.Name) // m.Name, Type: string
 	mylen += 8               // m.Time, Type: time.Time
 	mylen += 4               // m.Temp, Type: float32
@@ -0,0 +1,14 @@
+package refuge
+
+// Schedule is a weekly thermostat schedule.
+// Each block sets the thermostat settings from its start until the next block starts.
+type Schedule struct {
+	Blocks []ScheduleBlock
+}
+
+// ScheduleBlock is one time block of a Schedule.
+type ScheduleBlock struct {
+	Day      byte   // Day of the week the block starts, 0 is Sunday.
+	Minute   uint16 // Minute of the day the block starts, in the thermostat's local time.
+	Settings Settings
+}
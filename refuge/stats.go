@@ -7,7 +7,8 @@ import (
 // TempEvent is an event in the temp system.
 // Used to track stats through history
 type TempEvent struct {
-	Name     string       // Name of device
+	ID       string       // ID of device
+	Name     string       // Name of device at the time of the event
 	Time     time.Time    // Time of event
 	Temp     float32      // Last temp reading
 	Humidity float32      // Last humidity reading
@@ -0,0 +1,153 @@
+package rnet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lologarithm/netgen/lib/ngen"
+	"github.com/lologarithm/netgen/lib/ngservice"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// Signed messages are framed as:
+// magic (2) | unix nano timestamp (8) | random nonce (8) | ngservice packet | HMAC-SHA256 of everything before it (32)
+const (
+	sigHeaderLen = 2 + 8 + 8
+	sigLen       = sha256.Size
+)
+
+var sigMagic = [2]byte{'r', 's'}
+
+// replayWindow is how far a message timestamp can be from our clock before it is rejected.
+// Nonces are remembered for this long to reject replays inside the window.
+var replayWindow = time.Second * 30
+
+var signKey []byte
+
+// Nonces maps the nonces of messages read in the replay window to their timestamp, to reject replays of them.
+// Every connection needs its own: a broadcast reaches each connection listening for it and isn't a replay on any of them.
+// It isn't safe for concurrent use, each connection is read from a single goroutine.
+type Nonces map[string]int64
+
+// SetKey configures the shared household key. Once a key is set all messages
+// written by WriteTo are signed and ReadPacket drops any message that is
+// unsigned, signed with a different key or replayed.
+// Should be called before any network traffic starts.
+func SetKey(key string) {
+	if key == "" {
+		signKey = nil
+		sealer = nil
+		return
+	}
+	sum := sha256.Sum256([]byte(key))
+	signKey = sum[:]
+	setSealer(key)
+}
+
+// LoadKey reads the shared household key from the given file and configures it with SetKey.
+// An empty path leaves messages unsigned.
+func LoadKey(path string) {
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	failErr("read key file", err)
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		failErr("read key file", fmt.Errorf("%s is empty", path))
+	}
+	SetKey(key)
+}
+
+// WriteTo serializes the message and writes it to the given address, signing it if a key is configured
+// or encrypting it if encryption is required.
+// Messages are sealed at write time so every write gets a fresh timestamp and nonce.
+func WriteTo(conn *net.UDPConn, msg ngen.Message, addr *net.UDPAddr) (int, error) {
+	packet := ngservice.WriteMessage(Context, msg)
+	if encrypt {
+		packet = seal(packet, time.Now())
+	} else if signKey != nil {
+		packet = sign(packet, time.Now())
+	}
+	return conn.WriteToUDP(packet, addr)
+}
+
+// ReadPacket will read a packet of either rnet or refuge messages.
+// If a key is configured the packet must be signed or encrypted with it and not be a replay of one already
+// read with the same nonces. If encryption is required signed plaintext packets are dropped as well.
+func ReadPacket(b []byte, seen Nonces) (ngservice.Packet, bool) {
+	if signKey != nil {
+		var ok bool
+		if isSealed(b) {
+			b, ok = open(b, time.Now(), seen)
+		} else if !encrypt {
+			b, ok = verify(b, time.Now(), seen)
+		}
+		if !ok {
+			return ngservice.Packet{}, false
+		}
+	}
+	packet, ok := ngservice.ReadPacket(Context, b)
+	if !ok {
+		packet, ok = ngservice.ReadPacket(refuge.Context, b)
+	}
+	return packet, ok
+}
+
+func sign(packet []byte, now time.Time) []byte {
+	out := make([]byte, sigHeaderLen, sigHeaderLen+len(packet)+sigLen)
+	copy(out, sigMagic[:])
+	binary.LittleEndian.PutUint64(out[2:], uint64(now.UnixNano()))
+	rand.Read(out[10:sigHeaderLen])
+	out = append(out, packet...)
+
+	mac := hmac.New(sha256.New, signKey)
+	mac.Write(out)
+	return mac.Sum(out)
+}
+
+// verify checks the signature and freshness of a signed message and returns the packet inside it.
+func verify(b []byte, now time.Time, seen Nonces) ([]byte, bool) {
+	if len(b) < sigHeaderLen+sigLen || b[0] != sigMagic[0] || b[1] != sigMagic[1] {
+		return nil, false // Unsigned
+	}
+	body, sig := b[:len(b)-sigLen], b[len(b)-sigLen:]
+	mac := hmac.New(sha256.New, signKey)
+	mac.Write(body)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, false // Wrong key or tampered with
+	}
+
+	ts := int64(binary.LittleEndian.Uint64(b[2:]))
+	if !seen.fresh(ts, b[10:sigHeaderLen], now) {
+		return nil, false
+	}
+	return body[sigHeaderLen:], true
+}
+
+// fresh returns true if the message timestamp is inside the replay window and the nonce hasn't been seen before.
+func (s Nonces) fresh(ts int64, nonce []byte, now time.Time) bool {
+	window := int64(replayWindow)
+	diff := now.UnixNano() - ts
+	if diff > window || diff < -window {
+		return false
+	}
+
+	if _, ok := s[string(nonce)]; ok {
+		return false
+	}
+	for n, t := range s {
+		if now.UnixNano()-t > window {
+			delete(s, n)
+		}
+	}
+	s[string(nonce)] = ts
+	return true
+}
@@ -0,0 +1,174 @@
+package rnet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/netgen/lib/ngservice"
+)
+
+// testPacket is a serialized ping.
+func testPacket() []byte {
+	return ngservice.WriteMessage(Context, &Ping{Respond: true})
+}
+
+func TestSignVerify(t *testing.T) {
+	SetKey("household key")
+	defer SetKey("")
+	now := time.Now()
+	packet := testPacket()
+
+	tests := []struct {
+		name   string
+		signed func() []byte
+		at     time.Time
+		ok     bool
+	}{
+		{"good", func() []byte { return sign(packet, now) }, now, true},
+		{"clock a bit ahead", func() []byte { return sign(packet, now) }, now.Add(-20 * time.Second), true},
+		{"stale", func() []byte { return sign(packet, now) }, now.Add(replayWindow + time.Second), false},
+		{"from the future", func() []byte { return sign(packet, now) }, now.Add(-replayWindow - time.Second), false},
+		{"unsigned", func() []byte { return packet }, now, false},
+		{"tampered", func() []byte {
+			b := sign(packet, now)
+			b[sigHeaderLen] ^= 0x01
+			return b
+		}, now, false},
+		{"wrong key", func() []byte {
+			SetKey("neighbour's key")
+			defer SetKey("household key")
+			return sign(packet, now)
+		}, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := verify(tt.signed(), tt.at, Nonces{})
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if ok && !bytes.Equal(got, packet) {
+				t.Errorf("got packet %x, want %x", got, packet)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	SetKey("household key")
+	defer SetKey("")
+	now := time.Now()
+	packet := testPacket()
+
+	tests := []struct {
+		name   string
+		sealed func() []byte
+		at     time.Time
+		ok     bool
+	}{
+		{"good", func() []byte { return seal(packet, now) }, now, true},
+		{"stale", func() []byte { return seal(packet, now) }, now.Add(replayWindow + time.Second), false},
+		{"from the future", func() []byte { return seal(packet, now) }, now.Add(-replayWindow - time.Second), false},
+		{"signed", func() []byte { return sign(packet, now) }, now, false},
+		{"tampered", func() []byte {
+			b := seal(packet, now)
+			b[len(b)-1] ^= 0x01
+			return b
+		}, now, false},
+		{"header changed", func() []byte {
+			b := seal(packet, now)
+			b[2]++ // The timestamp is authenticated too.
+			return b
+		}, now, false},
+		{"wrong key", func() []byte {
+			SetKey("neighbour's key")
+			defer SetKey("household key")
+			return seal(packet, now)
+		}, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.sealed()
+			if tt.name == "good" && bytes.Contains(b, packet) {
+				t.Fatal("sealed message contains the plaintext packet")
+			}
+			got, ok := open(b, tt.at, Nonces{})
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if ok && !bytes.Equal(got, packet) {
+				t.Errorf("got packet %x, want %x", got, packet)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	SetKey("household key")
+	defer SetKey("")
+	now := time.Now()
+
+	for _, s := range []struct {
+		name string
+		seal func([]byte, time.Time) []byte
+		open func([]byte, time.Time, Nonces) ([]byte, bool)
+	}{{"signed", sign, verify}, {"sealed", seal, open}} {
+		b := s.seal(testPacket(), now)
+		seen := Nonces{}
+		if _, ok := s.open(b, now, seen); !ok {
+			t.Fatalf("%s: first read rejected", s.name)
+		}
+		if _, ok := s.open(b, now.Add(time.Second), seen); ok {
+			t.Errorf("%s: replay accepted", s.name)
+		}
+		// Another connection gets the same broadcast, it isn't a replay there.
+		if _, ok := s.open(b, now.Add(time.Second), Nonces{}); !ok {
+			t.Errorf("%s: rejected on a second connection", s.name)
+		}
+		// A new message from the same sender is fine.
+		if _, ok := s.open(s.seal(testPacket(), now), now.Add(time.Second), seen); !ok {
+			t.Errorf("%s: second message rejected", s.name)
+		}
+	}
+}
+
+func TestNoncesExpire(t *testing.T) {
+	now := time.Now()
+	seen := Nonces{}
+	seen.fresh(now.UnixNano(), []byte("old"), now)
+	later := now.Add(replayWindow + time.Second)
+	seen.fresh(later.UnixNano(), []byte("new"), later)
+	if _, ok := seen["old"]; ok || len(seen) != 1 {
+		t.Errorf("nonces outside the replay window kept: %v", seen)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	now := time.Now()
+	packet := testPacket()
+	if p, ok := ReadPacket(packet, Nonces{}); !ok || p.Header.MsgType != PingMsgType {
+		t.Fatal("unsigned ping not read without a key")
+	}
+
+	SetKey("household key")
+	defer SetKey("")
+	if _, ok := ReadPacket(packet, Nonces{}); ok {
+		t.Error("unsigned ping read with a key set")
+	}
+	p, ok := ReadPacket(sign(packet, now), Nonces{})
+	if !ok || !p.NetMsg.(*Ping).Respond {
+		t.Error("signed ping not read")
+	}
+	if _, ok := ReadPacket(seal(packet, now), Nonces{}); !ok {
+		t.Error("encrypted ping not read")
+	}
+
+	RequireEncryption(true)
+	defer RequireEncryption(false)
+	if _, ok := ReadPacket(sign(packet, now), Nonces{}); ok {
+		t.Error("signed plaintext ping read with encryption required")
+	}
+	if _, ok := ReadPacket(seal(packet, now), Nonces{}); !ok {
+		t.Error("encrypted ping not read with encryption required")
+	}
+}
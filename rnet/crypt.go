@@ -0,0 +1,75 @@
+package rnet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Encrypted messages are framed as:
+// magic (2) | unix nano timestamp (8) | random nonce (12) | AES-256-GCM sealed ngservice packet
+// The header is authenticated as additional data so the timestamp and nonce can't be changed.
+const (
+	encNonceLen  = 12
+	encHeaderLen = 2 + 8 + encNonceLen
+)
+
+var encMagic = [2]byte{'r', 'e'}
+
+var (
+	sealer  cipher.AEAD
+	encrypt bool
+)
+
+// RequireEncryption makes WriteTo encrypt every message and ReadPacket drop anything that isn't encrypted.
+// Encryption uses a key derived from the household key so SetKey or LoadKey must be called first.
+// Without it encrypted messages are still accepted, so the server and devices can be switched over one at a time.
+func RequireEncryption(require bool) {
+	if require && sealer == nil {
+		failErr("require encryption", errors.New("encryption needs a household key"))
+	}
+	encrypt = require
+}
+
+// setSealer derives the encryption key from the household key.
+// It is kept separate from the signing key so the same key is never used for both.
+func setSealer(key string) {
+	sum := sha256.Sum256([]byte("refuge encryption:" + key))
+	block, err := aes.NewCipher(sum[:])
+	failErr("create cipher", err)
+	sealer, err = cipher.NewGCM(block)
+	failErr("create cipher", err)
+}
+
+func isSealed(b []byte) bool {
+	return len(b) >= encHeaderLen && b[0] == encMagic[0] && b[1] == encMagic[1]
+}
+
+func seal(packet []byte, now time.Time) []byte {
+	out := make([]byte, encHeaderLen, encHeaderLen+len(packet)+sealer.Overhead())
+	copy(out, encMagic[:])
+	binary.LittleEndian.PutUint64(out[2:], uint64(now.UnixNano()))
+	rand.Read(out[10:encHeaderLen])
+	return sealer.Seal(out, out[10:encHeaderLen], packet, out)
+}
+
+// open decrypts an encrypted message, checks its freshness and returns the packet inside it.
+func open(b []byte, now time.Time, seen Nonces) ([]byte, bool) {
+	if !isSealed(b) {
+		return nil, false
+	}
+	header := b[:encHeaderLen]
+	packet, err := sealer.Open(nil, header[10:], b[encHeaderLen:], header)
+	if err != nil {
+		return nil, false // Wrong key or tampered with
+	}
+	ts := int64(binary.LittleEndian.Uint64(header[2:]))
+	if !seen.fresh(ts, header[10:], now) {
+		return nil, false
+	}
+	return packet, true
+}
@@ -0,0 +1,37 @@
+package rnet
+
+import (
+	"net"
+	"time"
+)
+
+// heartbeater sends periodic heartbeats from a device to its listeners.
+type heartbeater struct {
+	id       string
+	interval time.Duration
+	started  time.Time
+	last     time.Time
+	seq      uint64
+}
+
+// newHeartbeater creates a heartbeater for the device with the given ID.
+// An interval of 0 disables heartbeats.
+func newHeartbeater(id string, interval time.Duration) *heartbeater {
+	now := time.Now()
+	return &heartbeater{id: id, interval: interval, started: now, last: now}
+}
+
+// Beat will send a heartbeat to all listeners if the interval has passed since the last one.
+// Like BroadcastAndTimeout any idle listeners are removed.
+func (hb *heartbeater) Beat(conn *net.UDPConn, listeners []Listener) []Listener {
+	if hb.interval <= 0 || time.Now().Sub(hb.last) < hb.interval {
+		return listeners
+	}
+	hb.last = time.Now()
+	hb.seq++
+	return BroadcastAndTimeout(conn, &Heartbeat{
+		ID:     hb.id,
+		Uptime: int64(hb.last.Sub(hb.started).Seconds()),
+		Seq:    hb.seq,
+	}, listeners)
+}
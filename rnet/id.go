@@ -0,0 +1,39 @@
+package rnet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DeviceID returns the unique ID of this device.
+// On first boot a random ID is generated and stored next to the binary ("<binary>.id")
+// so the ID stays the same across restarts and renames of the device.
+func DeviceID() string {
+	exe, err := os.Executable()
+	failErr("find executable path", err)
+	return LoadID(exe + ".id")
+}
+
+// LoadID will read the ID stored in the given file or generate and store a new one if the file doesn't exist.
+func LoadID(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id
+		}
+	} else if !os.IsNotExist(err) {
+		failErr("read device id", err)
+	}
+
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	failErr("generate device id", err)
+	id := hex.EncodeToString(b)
+
+	failErr("write device id", ioutil.WriteFile(filepath.Clean(path), []byte(id+"\n"), 0644))
+	return id
+}
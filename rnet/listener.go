@@ -5,7 +5,7 @@ import (
 	"net"
 	"time"
 
-	"github.com/lologarithm/netgen/lib/ngservice"
+	"github.com/lologarithm/netgen/lib/ngen"
 )
 
 type Listener struct {
@@ -16,9 +16,9 @@ type Listener struct {
 
 var idleTimeout = int64(time.Duration(time.Minute * 30).Seconds())
 
-// BroadcastAndTimeout will broadcast the given msg bytes to all listener UDPAddr via the given udp conn.
+// BroadcastAndTimeout will broadcast the given msg to all listener UDPAddr via the given udp conn.
 // Any listeners who have been idle for over "idleTimeout" seconds will be removed.
-func BroadcastAndTimeout(conn *net.UDPConn, msg []byte, listeners []Listener) []Listener {
+func BroadcastAndTimeout(conn *net.UDPConn, msg ngen.Message, listeners []Listener) []Listener {
 	now := time.Now().Unix()
 	n := 0
 	for _, lsn := range listeners {
@@ -27,7 +27,7 @@ func BroadcastAndTimeout(conn *net.UDPConn, msg []byte, listeners []Listener) []
 		}
 		listeners[n] = lsn
 		n++
-		conn.WriteToUDP(msg, lsn.Addr)
+		WriteTo(conn, msg, lsn.Addr)
 	}
 	return listeners[:n]
 }
@@ -49,14 +49,15 @@ func UpdateListeners(listeners []Listener, addr *net.UDPAddr) []Listener {
 }
 
 // ReadBroadcastPing will attempt to read a ping message from given connection
-// with a timeout of 10 milliseconds. On success and if the ping requests a response, return response bytes.
-func ReadBroadcastPing(conn *net.UDPConn, listeners []Listener, b []byte, response []byte) []Listener {
+// with a timeout of 10 milliseconds. On success and if the ping requests a response, broadcast the response.
+// Seen is the replay cache of the connection.
+func ReadBroadcastPing(conn *net.UDPConn, listeners []Listener, b []byte, response ngen.Message, seen Nonces) []Listener {
 	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
 	n, remoteAddr, _ := conn.ReadFromUDP(b)
 	if n <= 0 {
 		return listeners
 	}
-	packet, ok := ngservice.ReadPacket(Context, b[:n])
+	packet, ok := ReadPacket(b[:n], seen)
 	if !ok || packet.Header.MsgType != PingMsgType {
 		return listeners
 	}
@@ -6,7 +6,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/lologarithm/netgen/lib/ngservice"
 	"gitlab.com/lologarithm/refuge/refuge"
 )
 
@@ -30,6 +29,33 @@ type Ping struct {
 	Respond bool
 }
 
+// Command is a request for a device to change its state.
+// Only the fields relevant to the device need to be set.
+type Command struct {
+	ReqID       uint64 // ID of the request, echoed back in the Ack
+	Switch      *refuge.Switch
+	Portal      *refuge.Portal
+	Settings    *refuge.Settings
+	Schedule    *refuge.Schedule // Replaces the thermostat schedule, an empty schedule removes it.
+	Setback     *refuge.Setback
+	Calibration *refuge.Calibration
+}
+
+// Ack is sent by a device once it has handled a Command.
+// It carries the state of the device after the change.
+type Ack struct {
+	ReqID  uint64
+	Device *refuge.Device
+}
+
+// Heartbeat is sent periodically by devices to let listeners know they are still alive.
+// Uptime and Seq start over when the device restarts.
+type Heartbeat struct {
+	ID     string // ID of the device
+	Uptime int64  // Seconds since the device started
+	Seq    uint64 // Incremented every heartbeat
+}
+
 func failErr(ctx string, e error) {
 	if e != nil {
 		print("Failed to " + ctx + ": " + e.Error())
@@ -94,7 +120,7 @@ func SetupUDPConns() (direct *net.UDPConn, broadcast *net.UDPConn) {
 	failErr("listen multicast udp", err)
 
 	// Ping the network to say we are online
-	direct.WriteToUDP(ngservice.WriteMessage(Context, &Ping{Respond: false}), RefugeDiscovery)
+	WriteTo(direct, &Ping{Respond: false}, RefugeDiscovery)
 
 	return direct, broadcast
 }
@@ -1,4 +1,4 @@
-// Code generated by netgen tool on Oct 2 2019 22:02 MDT. DO NOT EDIT
+// Code generated by netgen tool on Oct 18 2026 03:31 MDT. DO NOT EDIT
 package rnet
 
 import (
@@ -12,9 +12,13 @@ var Context = &ngen.Context{
 }
 
 const (
-	ListenerMsgType = 1827296884
-	MsgMsgType      = 1355225423
-	PingMsgType     = 2246546115
+	ListenerMsgType  = 1827296884
+	MsgMsgType       = 1355225423
+	PingMsgType      = 2246546115
+	CommandMsgType   = 1098371912
+	AckMsgType       = 447331921
+	HeartbeatMsgType = 2290904954
+	NodeMsgType      = 625821563
 )
 
 // Read accepts input of raw bytes and a type. Parses and returns a message.
@@ -31,6 +35,18 @@ func Read(ctx *ngen.Context, msgType ngen.MessageType, content *ngen.Buffer) nge
 	case PingMsgType:
 		msg := DeserializePing(ctx, content)
 		return &msg
+	case CommandMsgType:
+		msg := DeserializeCommand(ctx, content)
+		return &msg
+	case AckMsgType:
+		msg := DeserializeAck(ctx, content)
+		return &msg
+	case HeartbeatMsgType:
+		msg := DeserializeHeartbeat(ctx, content)
+		return &msg
+	case NodeMsgType:
+		msg := DeserializeNode(ctx, content)
+		return &msg
 
 	default:
 		return nil
@@ -55,3 +71,56 @@ func DeserializePing(ctx *ngen.Context, buffer *ngen.Buffer) (m Ping) {
 	m.Respond = buffer.ReadBool()
 	return m
 }
+
+func DeserializeCommand(ctx *ngen.Context, buffer *ngen.Buffer) (m Command) {
+	m.ReqID = buffer.ReadUint64()
+	if v := buffer.ReadByte(); v == 1 {
+		var subSwitch = refuge.DeserializeSwitch(ctx, buffer)
+		m.Switch = &subSwitch
+	}
+	if v := buffer.ReadByte(); v == 1 {
+		var subPortal = refuge.DeserializePortal(ctx, buffer)
+		m.Portal = &subPortal
+	}
+	if v := buffer.ReadByte(); v == 1 {
+		var subSettings = refuge.DeserializeSettings(ctx, buffer)
+		m.Settings = &subSettings
+	}
+	if v := buffer.ReadByte(); v == 1 {
+		var subSchedule = refuge.DeserializeSchedule(ctx, buffer)
+		m.Schedule = &subSchedule
+	}
+	if v := buffer.ReadByte(); v == 1 {
+		var subSetback = refuge.DeserializeSetback(ctx, buffer)
+		m.Setback = &subSetback
+	}
+	if v := buffer.ReadByte(); v == 1 {
+		var subCalibration = refuge.DeserializeCalibration(ctx, buffer)
+		m.Calibration = &subCalibration
+	}
+	return m
+}
+
+func DeserializeAck(ctx *ngen.Context, buffer *ngen.Buffer) (m Ack) {
+	m.ReqID = buffer.ReadUint64()
+	if v := buffer.ReadByte(); v == 1 {
+		var subDevice = refuge.DeserializeDevice(ctx, buffer)
+		m.Device = &subDevice
+	}
+	return m
+}
+
+func DeserializeHeartbeat(ctx *ngen.Context, buffer *ngen.Buffer) (m Heartbeat) {
+	m.ID = buffer.ReadString()
+	m.Uptime = buffer.ReadInt64()
+	m.Seq = buffer.ReadUint64()
+	return m
+}
+
+func DeserializeNode(ctx *ngen.Context, buffer *ngen.Buffer) (m Node) {
+	if v := buffer.ReadByte(); v == 1 {
+		var subDevice = refuge.DeserializeDevice(ctx, buffer)
+		m.Device = &subDevice
+	}
+	return m
+}
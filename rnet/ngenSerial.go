@@ -1,4 +1,4 @@
-// Code generated by netgen tool on Oct 2 2019 22:02 MDT. DO NOT EDIT
+// Code generated by netgen tool on Oct 18 2026 03:31 MDT. DO NOT EDIT
 package rnet
 
 import "github.com/lologarithm/netgen/lib/ngen"
@@ -61,3 +61,157 @@ func (m Ping) Length(ctx *ngen.Context) int {
 func (m Ping) MsgType() ngen.MessageType {
 	return PingMsgType
 }
+
+func (m Command) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteUint64(uint64(m.ReqID))
+	if m.Switch != nil {
+		buffer.WriteBool(true)
+		m.Switch.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	if m.Portal != nil {
+		buffer.WriteBool(true)
+		m.Portal.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	if m.Settings != nil {
+		buffer.WriteBool(true)
+		m.Settings.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	if m.Schedule != nil {
+		buffer.WriteBool(true)
+		m.Schedule.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	if m.Setback != nil {
+		buffer.WriteBool(true)
+		m.Setback.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+	if m.Calibration != nil {
+		buffer.WriteBool(true)
+		m.Calibration.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+
+	return buffer.Err
+}
+
+func (m Command) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 8 // m.ReqID, Type: uint64
+
+	mylen++ // nil check
+	if m.Switch != nil {
+		mylen += m.Switch.Length(ctx)
+	} // m.Switch, Type: refuge.Switch
+
+	mylen++ // nil check
+	if m.Portal != nil {
+		mylen += m.Portal.Length(ctx)
+	} // m.Portal, Type: refuge.Portal
+
+	mylen++ // nil check
+	if m.Settings != nil {
+		mylen += m.Settings.Length(ctx)
+	} // m.Settings, Type: refuge.Settings
+
+	mylen++ // nil check
+	if m.Schedule != nil {
+		mylen += m.Schedule.Length(ctx)
+	} // m.Schedule, Type: refuge.Schedule
+
+	mylen++ // nil check
+	if m.Setback != nil {
+		mylen += m.Setback.Length(ctx)
+	} // m.Setback, Type: refuge.Setback
+
+	mylen++ // nil check
+	if m.Calibration != nil {
+		mylen += m.Calibration.Length(ctx)
+	} // m.Calibration, Type: refuge.Calibration
+	return mylen
+}
+
+func (m Command) MsgType() ngen.MessageType {
+	return CommandMsgType
+}
+
+func (m Ack) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteUint64(uint64(m.ReqID))
+	if m.Device != nil {
+		buffer.WriteBool(true)
+		m.Device.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+
+	return buffer.Err
+}
+
+func (m Ack) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 8 // m.ReqID, Type: uint64
+
+	mylen++ // nil check
+	if m.Device != nil {
+		mylen += m.Device.Length(ctx)
+	} // m.Device, Type: refuge.Device
+	return mylen
+}
+
+func (m Ack) MsgType() ngen.MessageType {
+	return AckMsgType
+}
+
+func (m Heartbeat) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	buffer.WriteString(m.ID)
+	buffer.WriteUint64(uint64(m.Uptime))
+	buffer.WriteUint64(uint64(m.Seq))
+
+	return buffer.Err
+}
+
+func (m Heartbeat) Length(ctx *ngen.Context) int {
+	mylen := 0
+	mylen += 4 + len(m.ID) // m.ID, Type: string
+	mylen += 8             // m.Uptime, Type: int64
+	mylen += 8             // m.Seq, Type: uint64
+	return mylen
+}
+
+func (m Heartbeat) MsgType() ngen.MessageType {
+	return HeartbeatMsgType
+}
+
+func (m Node) Serialize(ctx *ngen.Context, buffer *ngen.Buffer) error {
+	if m.Device != nil {
+		buffer.WriteBool(true)
+		m.Device.Serialize(ctx, buffer)
+	} else {
+		buffer.WriteBool(false)
+	}
+
+	return buffer.Err
+}
+
+func (m Node) Length(ctx *ngen.Context) int {
+	mylen := 0
+
+	mylen++ // nil check
+	if m.Device != nil {
+		mylen += m.Device.Length(ctx)
+	} // m.Device, Type: refuge.Device
+	return mylen
+}
+
+func (m Node) MsgType() ngen.MessageType {
+	return NodeMsgType
+}
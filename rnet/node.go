@@ -0,0 +1,189 @@
+package rnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/lologarithm/netgen/lib/ngen"
+	"github.com/lologarithm/netgen/lib/ngservice"
+	"gitlab.com/lologarithm/refuge/refuge"
+)
+
+// Handler is called with a message of the type it was registered for and the address it came from.
+type Handler func(msg ngen.Message, from *net.UDPAddr)
+
+// Node is a device on the refuge network.
+// It owns the sockets and listeners, answers pings, sends heartbeats and publishes the device state.
+// Requested changes are dispatched to the callbacks for each kind of state and acked with the resulting state.
+//
+// All callbacks and the tick function passed to Run are called from the Run goroutine,
+// so they can freely read and modify Device without locking.
+type Node struct {
+	Device *refuge.Device // State of the device, sent to listeners by Publish.
+
+	// Called with the requested state, either from a Command or a bare state message.
+	OnSwitch   func(refuge.Switch)
+	OnPortal   func(refuge.Portal)
+	OnSettings func(refuge.Settings)
+	OnSchedule func(refuge.Schedule)
+	OnSetback  func(refuge.Setback)
+
+	// Called with a new calibration for the thermometer.
+	OnCalibration func(refuge.Calibration)
+
+	// Called with the occupancy and remote temp readings the server sends to thermostats using them.
+	OnOccupancy  func(refuge.Occupancy)
+	OnRemoteTemp func(refuge.RemoteTemp)
+
+	direct     *net.UDPConn
+	broadcasts *net.UDPConn
+	listeners  []Listener
+	hb         *heartbeater
+	msg        *Msg
+	handlers   map[ngen.MessageType]Handler
+	acks       []pendingAck
+	nonces     Nonces // Replay cache of both sockets.
+	b          []byte
+}
+
+// pendingAck is a command that has been handled but not acked yet.
+type pendingAck struct {
+	reqID uint64
+	addr  *net.UDPAddr
+}
+
+// NewNode opens the sockets for the device and announces it on the network.
+// The device ID defaults to DeviceID and its address is set to the direct socket.
+// An interval of 0 disables heartbeats.
+func NewNode(dev *refuge.Device, heartbeat time.Duration) *Node {
+	direct, broadcasts := SetupUDPConns()
+	if dev.ID == "" {
+		dev.ID = DeviceID()
+	}
+	dev.Addr = direct.LocalAddr().String()
+	n := &Node{
+		Device:     dev,
+		direct:     direct,
+		broadcasts: broadcasts,
+		hb:         newHeartbeater(dev.ID, heartbeat),
+		nonces:     Nonces{},
+		msg:        &Msg{Device: dev},
+		handlers:   map[ngen.MessageType]Handler{},
+		b:          make([]byte, 1024),
+	}
+	n.Handle(CommandMsgType, n.handleCommand)
+	n.Handle(refuge.SwitchMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		n.dispatch(&Command{Switch: msg.(*refuge.Switch)})
+	})
+	n.Handle(refuge.PortalMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		n.dispatch(&Command{Portal: msg.(*refuge.Portal)})
+	})
+	n.Handle(refuge.SettingsMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		n.dispatch(&Command{Settings: msg.(*refuge.Settings)})
+	})
+	n.Handle(refuge.OccupancyMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		if n.OnOccupancy != nil {
+			n.OnOccupancy(*msg.(*refuge.Occupancy))
+		}
+	})
+	n.Handle(refuge.RemoteTempMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		if n.OnRemoteTemp != nil {
+			n.OnRemoteTemp(*msg.(*refuge.RemoteTemp))
+		}
+	})
+	n.Handle(PingMsgType, func(msg ngen.Message, from *net.UDPAddr) {
+		// Just letting us know to respond to them now.
+		WriteTo(n.direct, n.msg, from)
+	})
+	return n
+}
+
+// Handle registers the handler for direct messages of the given type, replacing any existing one.
+func (n *Node) Handle(t ngen.MessageType, h Handler) {
+	n.handlers[t] = h
+}
+
+// Publish sends the current device state to all listeners.
+func (n *Node) Publish() {
+	n.listeners = BroadcastAndTimeout(n.direct, n.msg, n.listeners)
+}
+
+// Run polls the network until the context is done, calling tick after every poll.
+// A poll waits up to interval for a direct message, so tick runs sooner when requests arrive.
+// Commands are acked after the following tick so the ack carries the state after acting on them.
+// The sockets are closed when Run returns.
+func (n *Node) Run(ctx context.Context, interval time.Duration, tick func()) {
+	defer n.close()
+	for ctx.Err() == nil {
+		n.poll(interval)
+		if tick != nil {
+			tick()
+		}
+		for _, a := range n.acks {
+			WriteTo(n.direct, &Ack{ReqID: a.reqID, Device: n.Device}, a.addr)
+		}
+		n.acks = n.acks[:0]
+	}
+}
+
+func (n *Node) poll(interval time.Duration) {
+	// Check for broadcast pings
+	n.listeners = ReadBroadcastPing(n.broadcasts, n.listeners, n.b, n.msg, n.nonces)
+	n.listeners = n.hb.Beat(n.direct, n.listeners)
+
+	n.direct.SetReadDeadline(time.Now().Add(interval))
+	size, remoteAddr, _ := n.direct.ReadFromUDP(n.b)
+	if size <= 0 {
+		return
+	}
+	n.listeners = UpdateListeners(n.listeners, remoteAddr)
+	packet, ok := ReadPacket(n.b[:size], n.nonces)
+	if !ok {
+		return
+	}
+	n.handle(packet, remoteAddr)
+}
+
+func (n *Node) handle(packet ngservice.Packet, from *net.UDPAddr) {
+	h, ok := n.handlers[packet.Header.MsgType]
+	if !ok {
+		fmt.Printf("Got message of unknown type: %d\n", packet.Header.MsgType)
+		return
+	}
+	h(packet.NetMsg, from)
+}
+
+func (n *Node) handleCommand(msg ngen.Message, from *net.UDPAddr) {
+	cmd := msg.(*Command)
+	n.dispatch(cmd)
+	n.acks = append(n.acks, pendingAck{reqID: cmd.ReqID, addr: from})
+}
+
+// dispatch calls the callback for each requested change in the command.
+func (n *Node) dispatch(cmd *Command) {
+	if cmd.Switch != nil && n.OnSwitch != nil {
+		n.OnSwitch(*cmd.Switch)
+	}
+	if cmd.Portal != nil && n.OnPortal != nil {
+		n.OnPortal(*cmd.Portal)
+	}
+	if cmd.Settings != nil && n.OnSettings != nil {
+		n.OnSettings(*cmd.Settings)
+	}
+	if cmd.Schedule != nil && n.OnSchedule != nil {
+		n.OnSchedule(*cmd.Schedule)
+	}
+	if cmd.Setback != nil && n.OnSetback != nil {
+		n.OnSetback(*cmd.Setback)
+	}
+	if cmd.Calibration != nil && n.OnCalibration != nil {
+		n.OnCalibration(*cmd.Calibration)
+	}
+}
+
+func (n *Node) close() {
+	n.direct.Close()
+	n.broadcasts.Close()
+}
@@ -0,0 +1,203 @@
+package sensor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultI2CBus is the I2C bus on the raspberry pi header pins.
+const DefaultI2CBus = "/dev/i2c-1"
+
+// DefaultBME280Addr is the I2C address of a BME280 with SDO pulled low, 0x77 when pulled high.
+const DefaultBME280Addr = 0x76
+
+// BME280 registers, see the Bosch BME280 datasheet.
+const (
+	bmeCalib1   = 0x88 // T1-T3, P1-P9 and H1, 26 bytes
+	bmeChipID   = 0xD0
+	bmeCalib2   = 0xE1 // H2-H6, 7 bytes
+	bmeCtrlHum  = 0xF2
+	bmeStatus   = 0xF3
+	bmeCtrlMeas = 0xF4
+	bmeData     = 0xF7 // pressure, temp and humidity, 8 bytes
+
+	bmeID        = 0x60
+	bmeMeasuring = 0x08
+)
+
+// BME280 is a temp/humidity/pressure sensor on an I2C bus.
+// Each read triggers a single (forced mode) measurement so the sensor sleeps in between.
+type BME280 struct {
+	bus io.ReadWriter
+	cal bmeCalibration
+}
+
+// bmeCalibration holds the compensation parameters stored in the sensor at the factory.
+type bmeCalibration struct {
+	t1                             uint16
+	t2, t3                         int16
+	p1                             uint16
+	p2, p3, p4, p5, p6, p7, p8, p9 int16
+	h1, h3                         uint8
+	h2, h4, h5                     int16
+	h6                             int8
+}
+
+// OpenBME280 opens the sensor at addr on the I2C bus device.
+// Empty bus and 0 addr use DefaultI2CBus and DefaultBME280Addr.
+func OpenBME280(bus string, addr uint16) (*BME280, error) {
+	if bus == "" {
+		bus = DefaultI2CBus
+	}
+	if addr == 0 {
+		addr = DefaultBME280Addr
+	}
+	rw, err := openI2C(bus, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", bus, err)
+	}
+	b, err := NewBME280(rw)
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewBME280 sets up the sensor on a bus already addressed to it and loads its calibration.
+// Register reads are a write of the register address followed by a read.
+func NewBME280(bus io.ReadWriter) (*BME280, error) {
+	b := &BME280{bus: bus}
+	id, err := b.readReg(bmeChipID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if id[0] != bmeID {
+		return nil, fmt.Errorf("not a BME280, chip id is 0x%02x", id[0])
+	}
+	c1, err := b.readReg(bmeCalib1, 26)
+	if err != nil {
+		return nil, err
+	}
+	c2, err := b.readReg(bmeCalib2, 7)
+	if err != nil {
+		return nil, err
+	}
+	u16 := func(b []byte) uint16 { return binary.LittleEndian.Uint16(b) }
+	s16 := func(b []byte) int16 { return int16(u16(b)) }
+	b.cal = bmeCalibration{
+		t1: u16(c1[0:]), t2: s16(c1[2:]), t3: s16(c1[4:]),
+		p1: u16(c1[6:]), p2: s16(c1[8:]), p3: s16(c1[10:]), p4: s16(c1[12:]), p5: s16(c1[14:]),
+		p6: s16(c1[16:]), p7: s16(c1[18:]), p8: s16(c1[20:]), p9: s16(c1[22:]),
+		h1: c1[25],
+		h2: s16(c2[0:]),
+		h3: c2[2],
+		// H4 and H5 are 12 bit values sharing a nibble of 0xE5.
+		h4: int16(int8(c2[3]))<<4 | int16(c2[4]&0x0F),
+		h5: int16(int8(c2[5]))<<4 | int16(c2[4]>>4),
+		h6: int8(c2[6]),
+	}
+	// Humidity oversampling has to be set before ctrl_meas to take effect.
+	if err := b.writeReg(bmeCtrlHum, 0x01); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Read implements Thermometer.
+func (b *BME280) Read(includeWait bool) (ThermalReading, error) {
+	// Temp and pressure oversampling x1, forced mode.
+	if err := b.writeReg(bmeCtrlMeas, 0x25); err != nil {
+		return ThermalReading{}, err
+	}
+	// A measurement at x1 oversampling takes under 10ms.
+	for i := 0; ; i++ {
+		time.Sleep(time.Millisecond * 10)
+		status, err := b.readReg(bmeStatus, 1)
+		if err != nil {
+			return ThermalReading{}, err
+		}
+		if status[0]&bmeMeasuring == 0 {
+			break
+		}
+		if i == 10 {
+			return ThermalReading{}, fmt.Errorf("BME280 measurement didn't finish")
+		}
+	}
+	d, err := b.readReg(bmeData, 8)
+	if err != nil {
+		return ThermalReading{}, err
+	}
+	adcP := int32(d[0])<<12 | int32(d[1])<<4 | int32(d[2])>>4
+	adcT := int32(d[3])<<12 | int32(d[4])<<4 | int32(d[5])>>4
+	adcH := int32(d[6])<<8 | int32(d[7])
+	temp, fine := b.cal.temp(adcT)
+	return ThermalReading{
+		Temp:     float32(temp),
+		Humi:     float32(b.cal.humidity(adcH, fine)),
+		Pressure: float32(b.cal.pressure(adcP, fine) / 100),
+	}, nil
+}
+
+func (b *BME280) readReg(reg byte, n int) ([]byte, error) {
+	if _, err := b.bus.Write([]byte{reg}); err != nil {
+		return nil, fmt.Errorf("BME280 write failed: %s", err)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(b.bus, buf); err != nil {
+		return nil, fmt.Errorf("BME280 read failed: %s", err)
+	}
+	return buf, nil
+}
+
+func (b *BME280) writeReg(reg, v byte) error {
+	if _, err := b.bus.Write([]byte{reg, v}); err != nil {
+		return fmt.Errorf("BME280 write failed: %s", err)
+	}
+	return nil
+}
+
+// The compensation below is the floating point version from the datasheet.
+
+// temp returns the temp (C) and the fine temp the pressure and humidity compensation depend on.
+func (c bmeCalibration) temp(adc int32) (float64, float64) {
+	v1 := (float64(adc)/16384 - float64(c.t1)/1024) * float64(c.t2)
+	v2 := float64(adc)/131072 - float64(c.t1)/8192
+	v2 = v2 * v2 * float64(c.t3)
+	return (v1 + v2) / 5120, v1 + v2
+}
+
+// pressure returns the pressure in Pa.
+func (c bmeCalibration) pressure(adc int32, fine float64) float64 {
+	v1 := fine/2 - 64000
+	v2 := v1 * v1 * float64(c.p6) / 32768
+	v2 += v1 * float64(c.p5) * 2
+	v2 = v2/4 + float64(c.p4)*65536
+	v1 = (float64(c.p3)*v1*v1/524288 + float64(c.p2)*v1) / 524288
+	v1 = (1 + v1/32768) * float64(c.p1)
+	if v1 == 0 {
+		return 0 // Avoid dividing by zero on a sensor without calibration.
+	}
+	p := 1048576 - float64(adc)
+	p = (p - v2/4096) * 6250 / v1
+	v1 = float64(c.p9) * p * p / 2147483648
+	v2 = p * float64(c.p8) / 32768
+	return p + (v1+v2+float64(c.p7))/16
+}
+
+// humidity returns the relative humidity (%).
+func (c bmeCalibration) humidity(adc int32, fine float64) float64 {
+	h := fine - 76800
+	h = (float64(adc) - (float64(c.h4)*64 + float64(c.h5)/16384*h)) *
+		(float64(c.h2) / 65536 * (1 + float64(c.h6)/67108864*h*(1+float64(c.h3)/67108864*h)))
+	h *= 1 - float64(c.h1)*h/524288
+	if h > 100 {
+		return 100
+	}
+	if h < 0 {
+		return 0
+	}
+	return h
+}
@@ -0,0 +1,171 @@
+package sensor
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// fakeI2C is a BME280 register file. Writing a single byte sets the register to read from,
+// writing two sets a register.
+type fakeI2C struct {
+	regs   [256]byte
+	ptr    int
+	writes [][2]byte
+}
+
+func (f *fakeI2C) Write(p []byte) (int, error) {
+	switch len(p) {
+	case 1:
+		f.ptr = int(p[0])
+	case 2:
+		f.regs[p[0]] = p[1]
+		f.writes = append(f.writes, [2]byte{p[0], p[1]})
+	}
+	return len(p), nil
+}
+
+func (f *fakeI2C) Read(p []byte) (int, error) {
+	n := copy(p, f.regs[f.ptr:])
+	f.ptr += n
+	return n, nil
+}
+
+// bmeSample is a set of calibration parameters and raw readings.
+type bmeSample struct {
+	t1                             uint16
+	t2, t3                         int16
+	p1                             uint16
+	p2, p3, p4, p5, p6, p7, p8, p9 int16
+	h1, h3                         uint8
+	h2, h4, h5                     int16
+	h6                             int8
+	adcT, adcP, adcH               int32
+}
+
+// datasheetSample is the temp and pressure calibration and readings of the example in the BME280/BMP280
+// datasheets, with humidity calibration from a real sensor.
+var datasheetSample = bmeSample{
+	t1: 27504, t2: 26435, t3: -1000,
+	p1: 36477, p2: -10685, p3: 3024, p4: 2855, p5: 140, p6: -7, p7: 15500, p8: -14600, p9: 6000,
+	h1: 75, h2: 362, h3: 0, h4: 313, h5: 50, h6: 30,
+	adcT: 519888, adcP: 415148, adcH: 27500,
+}
+
+// newFakeBME280 lays out the sample in the sensor registers.
+func newFakeBME280(s bmeSample) *fakeI2C {
+	f := &fakeI2C{}
+	f.regs[bmeChipID] = bmeID
+	c1 := f.regs[bmeCalib1:]
+	for i, v := range []uint16{s.t1, uint16(s.t2), uint16(s.t3), s.p1, uint16(s.p2), uint16(s.p3), uint16(s.p4),
+		uint16(s.p5), uint16(s.p6), uint16(s.p7), uint16(s.p8), uint16(s.p9)} {
+		binary.LittleEndian.PutUint16(c1[i*2:], v)
+	}
+	c1[25] = s.h1
+	c2 := f.regs[bmeCalib2:]
+	binary.LittleEndian.PutUint16(c2, uint16(s.h2))
+	c2[2] = s.h3
+	// H4 is 0xE4 and the low nibble of 0xE5, H5 is the high nibble of 0xE5 and 0xE6.
+	c2[3] = byte(s.h4 >> 4)
+	c2[4] = byte(s.h4&0x0F) | byte(s.h5&0x0F)<<4
+	c2[5] = byte(s.h5 >> 4)
+	c2[6] = byte(s.h6)
+	d := f.regs[bmeData:]
+	d[0], d[1], d[2] = byte(s.adcP>>12), byte(s.adcP>>4), byte(s.adcP<<4)
+	d[3], d[4], d[5] = byte(s.adcT>>12), byte(s.adcT>>4), byte(s.adcT<<4)
+	d[6], d[7] = byte(s.adcH>>8), byte(s.adcH)
+	return f
+}
+
+// humidityInt is the 32 bit integer humidity compensation of the datasheet, returning %RH.
+func humidityInt(s bmeSample) float64 {
+	// Go's shifts bind tighter than + and -, unlike C, so this is parenthesized more than the datasheet.
+	v1 := (((s.adcT >> 3) - (int32(s.t1) << 1)) * int32(s.t2)) >> 11
+	v2 := (((((s.adcT >> 4) - int32(s.t1)) * ((s.adcT >> 4) - int32(s.t1))) >> 12) * int32(s.t3)) >> 14
+	x := v1 + v2 - 76800
+	x = ((((s.adcH << 14) - (int32(s.h4) << 20) - (int32(s.h5) * x)) + 16384) >> 15) *
+		(((((((x*int32(s.h6))>>10)*(((x*int32(s.h3))>>11)+32768))>>10)+2097152)*int32(s.h2) + 8192) >> 14)
+	x -= ((((x >> 15) * (x >> 15)) >> 7) * int32(s.h1)) >> 4
+	if x < 0 {
+		x = 0
+	}
+	if x > 419430400 {
+		x = 419430400
+	}
+	return float64(x>>12) / 1024
+}
+
+func TestBME280Datasheet(t *testing.T) {
+	bus := newFakeBME280(datasheetSample)
+	b, err := NewBME280(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bmeCalibration{
+		t1: 27504, t2: 26435, t3: -1000,
+		p1: 36477, p2: -10685, p3: 3024, p4: 2855, p5: 140, p6: -7, p7: 15500, p8: -14600, p9: 6000,
+		h1: 75, h2: 362, h3: 0, h4: 313, h5: 50, h6: 30,
+	}
+	if b.cal != want {
+		t.Fatalf("calibration\n got %+v\nwant %+v", b.cal, want)
+	}
+
+	tr, err := b.Read(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The datasheet gives 25.08C and 100653.27 Pa (float) / 100653 Pa (integer).
+	if math.Abs(float64(tr.Temp)-25.08) > 0.005 {
+		t.Errorf("temp %.3fC, want 25.08C", tr.Temp)
+	}
+	if math.Abs(float64(tr.Pressure)-1006.5327) > 0.01 {
+		t.Errorf("pressure %.4f hPa, want 1006.5327 hPa", tr.Pressure)
+	}
+	if h := humidityInt(datasheetSample); math.Abs(float64(tr.Humi)-h) > 0.05 {
+		t.Errorf("humidity %.3f%%, want %.3f%% from the integer compensation", tr.Humi, h)
+	}
+
+	// Humidity oversampling is set before the forced measurement that applies it.
+	if len(bus.writes) != 2 || bus.writes[0] != [2]byte{bmeCtrlHum, 0x01} || bus.writes[1] != [2]byte{bmeCtrlMeas, 0x25} {
+		t.Errorf("register writes %x, want ctrl_hum then ctrl_meas", bus.writes)
+	}
+}
+
+func TestBME280HumidityCalibration(t *testing.T) {
+	// H4 and H5 are signed 12 bit values, sharing the nibbles of 0xE5.
+	for _, hc := range [][2]int16{{313, 50}, {-313, -50}, {2047, -2048}, {0x123, 0x456}} {
+		s := datasheetSample
+		s.h4, s.h5 = hc[0], hc[1]
+		b, err := NewBME280(newFakeBME280(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.cal.h4 != s.h4 || b.cal.h5 != s.h5 {
+			t.Errorf("H4/H5 %d/%d decoded as %d/%d", s.h4, s.h5, b.cal.h4, b.cal.h5)
+		}
+	}
+
+	for _, adc := range []int32{20000, 27500, 35000, 45000} {
+		s := datasheetSample
+		s.adcH = adc
+		b, err := NewBME280(newFakeBME280(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr, err := b.Read(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := humidityInt(s); math.Abs(float64(tr.Humi)-h) > 0.05 {
+			t.Errorf("adc %d: humidity %.3f%%, want %.3f%%", adc, tr.Humi, h)
+		}
+	}
+}
+
+func TestBME280ChipID(t *testing.T) {
+	bus := newFakeBME280(datasheetSample)
+	bus.regs[bmeChipID] = 0x58 // A BMP280, no humidity.
+	if _, err := NewBME280(bus); err == nil {
+		t.Error("accepted a chip that isn't a BME280")
+	}
+}
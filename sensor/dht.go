@@ -0,0 +1,219 @@
+package sensor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+)
+
+const (
+	maxWait = int64(time.Millisecond) // 100us
+)
+
+// dhtPulses is the number of pulses in a frame: the 80us low/high response followed by a low/high pulse per bit.
+const dhtPulses = 2 + 40*2
+
+// DHTModel is a sensor of the DHT family. They all send the same 40 bit frame, but encode the
+// temp and humidity in it differently.
+type DHTModel byte
+
+const (
+	ModelDHT22  DHTModel = iota // 0.1C/0.1% resolution, -40 to 80C.
+	ModelDHT11                  // 1% and 0.1C resolution, 0 to 50C (negative temps on newer ones).
+	ModelAM2302                 // A wired DHT22.
+)
+
+// IsDHT returns true if the sensor kind is a DHT, read over a gpio pin. Empty is a DHT22.
+func IsDHT(kind string) bool {
+	return kind == "" || kind == KindDHT22 || kind == KindDHT11 || kind == KindAM2302
+}
+
+// DHTModelOf returns the model for a sensor kind, DHT22 for anything that isn't a DHT.
+func DHTModelOf(kind string) DHTModel {
+	switch kind {
+	case KindDHT11:
+		return ModelDHT11
+	case KindAM2302:
+		return ModelAM2302
+	}
+	return ModelDHT22
+}
+
+func (m DHTModel) String() string {
+	switch m {
+	case ModelDHT11:
+		return "DHT11"
+	case ModelAM2302:
+		return "AM2302"
+	}
+	return "DHT22"
+}
+
+// DHT is a DHT11/DHT22/AM2302 temp/humidity sensor bit-banged over a single data pin.
+type DHT struct {
+	Pin   gpio.Pin
+	Model DHTModel
+}
+
+// Read implements Thermometer. The GC is turned off while capturing so it doesn't throw off the pulse timing.
+func (d *DHT) Read(includeWait bool) (ThermalReading, error) {
+	debug.SetGCPercent(-1)
+	pulses, err := CaptureDHT(d.Pin, includeWait)
+	debug.SetGCPercent(100)
+	if err != nil {
+		return ThermalReading{}, err
+	}
+	t, h, err := DecodeDHT(d.Model, pulses)
+	if err != nil {
+		return ThermalReading{}, fmt.Errorf("bad %s frame: %s", d.Model, err)
+	}
+	return ThermalReading{Temp: t, Humi: h}, nil
+}
+
+// ReadDHT22 reads a DHT22 and returns the temp, humidity and whether it was a good reading.
+func ReadDHT22(pin gpio.Pin, includeWait bool) (float32, float32, bool) {
+	pulses, err := CaptureDHT(pin, includeWait)
+	if err != nil {
+		return -1, -1, false
+	}
+	t, h, err := DecodeDHT(ModelDHT22, pulses)
+	return t, h, err == nil
+}
+
+// CaptureDHT signals the sensor to send a frame and returns the length of each low and high pulse
+// of its answer, starting with the 80us low/high response. Lengths are in spins of the read loop,
+// so only their relative lengths mean anything. The pulses stop early if the sensor stops answering.
+func CaptureDHT(pin gpio.Pin, includeWait bool) ([]int64, error) {
+	// early allocations before time critical code
+	pulseLen := make([]int64, dhtPulses)
+
+	if includeWait {
+		time.Sleep(2000 * time.Millisecond)
+	}
+	pin.Output()
+	pin.High()
+
+	// send init values
+	time.Sleep(400 * time.Millisecond)
+	pin.Low()
+
+	// spinlock for milliseconds while pin is low.
+	// this signals the request for reading
+	s := time.Now().UnixNano()
+	to := int64(time.Millisecond * 20)
+	for time.Now().UnixNano()-s < to {
+	}
+	pin.Input()
+	pin.Pull(gpio.PullUp)
+	defer pin.Pull(gpio.PullOff)
+
+	// now we wait for DHT to pull low
+	s = time.Now().UnixNano()
+	firstWaitMax := int64(time.Millisecond * 5)
+	for pin.Read() {
+		if time.Now().UnixNano()-s > firstWaitMax {
+			return nil, fmt.Errorf("sensor never answered") // probably retry
+		}
+	}
+
+	// DHT pulls low for 80us and then 80us to signal its starting
+	// After that we read 40 low and 40 high pulses.
+	var end int64
+	for i := 0; i < dhtPulses; i += 2 {
+		s = 0
+		end = 0
+		// read low pulseLen
+		for !pin.Read() {
+			if end-s > maxWait {
+				return pulseLen[:i], nil
+			}
+			end++
+		}
+		pulseLen[i] = end - s
+
+		s = 0
+		end = 0
+		// read high pulse length
+		for pin.Read() {
+			if end-s > maxWait {
+				return pulseLen[:i+1], nil
+			}
+			end++
+		}
+		pulseLen[i+1] = end - s
+	}
+	return pulseLen, nil
+}
+
+// DecodeDHT turns the pulses of a frame into the temp and humidity it holds.
+// Each bit is a low pulse followed by a high pulse: short (26-28us) for 0 and long (70us) for 1.
+// The low pulses are always 50us, so their average is the threshold between short and long.
+func DecodeDHT(model DHTModel, pulses []int64) (float32, float32, error) {
+	if len(pulses) < dhtPulses {
+		bits := 0
+		if len(pulses) > 2 {
+			bits = (len(pulses) - 2) / 2
+		}
+		return 0, 0, fmt.Errorf("frame ended after %d of 40 bits", bits)
+	}
+
+	var threshold int64
+	for i := 2; i < dhtPulses; i += 2 {
+		threshold += pulses[i]
+	}
+	threshold /= 40
+	if threshold == 0 {
+		return 0, 0, fmt.Errorf("no low pulses in frame")
+	}
+
+	// convert to bytes
+	bytes := make([]uint8, 5)
+	for i := 3; i < dhtPulses; i += 2 {
+		bi := (i - 3) / 16
+		bytes[bi] <<= 1
+		if pulses[i] > threshold {
+			bytes[bi] |= 0x01
+		}
+	}
+	if !checksum(bytes) {
+		return 0, 0, fmt.Errorf("checksum 0x%02x doesn't match data %x", bytes[4], bytes[:4])
+	}
+	if bytes[0] == 0 && bytes[1] == 0 && bytes[2] == 0 && bytes[3] == 0 {
+		return 0, 0, fmt.Errorf("empty frame") // All 0s passes the checksum, but isn't a reading.
+	}
+
+	var temperature, humidity float32
+	switch model {
+	case ModelDHT11:
+		// Whole and tenths of the humidity and temp, the top bit of the temp tenths marks it negative.
+		humidity = float32(bytes[0]) + float32(bytes[1])/10
+		temperature = float32(bytes[2]) + float32(bytes[3]&0x7F)/10
+		if bytes[3]&0x80 > 0 {
+			temperature *= -1
+		}
+	default:
+		// Tenths of the humidity and temp, the top bit of the temp marks it negative.
+		humidity = float32(uint16(bytes[0])*256+uint16(bytes[1])) / 10.0
+		temperature = float32((uint16(bytes[2])&0x7F)*256+uint16(bytes[3])) / 10.0
+		if uint16(bytes[2])&0x80 > 0 {
+			temperature *= -1
+		}
+	}
+	if humidity > 100 {
+		return 0, 0, fmt.Errorf("humidity %.1f%% out of range", humidity)
+	}
+	if temperature < -40 || temperature > 80 {
+		return 0, 0, fmt.Errorf("temp %.1fC out of range", temperature)
+	}
+	return temperature, humidity, nil
+}
+
+func checksum(bytes []uint8) bool {
+	var sum uint8
+	for i := 0; i < 4; i++ {
+		sum += bytes[i]
+	}
+	return sum == bytes[4]
+}
@@ -0,0 +1,138 @@
+package sensor
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+)
+
+// dhtFrame encodes the temperature and humidity the way the model sends them, followed by the checksum.
+func dhtFrame(model DHTModel, temp, humi float32) []uint8 {
+	var data []uint8
+	if model == ModelDHT11 {
+		t := uint8(abs(temp))
+		tenths := uint8((abs(temp) - float32(t)) * 10)
+		if temp < 0 {
+			tenths |= 0x80
+		}
+		data = []uint8{uint8(humi), uint8((humi - float32(uint8(humi))) * 10), t, tenths}
+	} else {
+		h := uint16(humi * 10)
+		t := uint16(abs(temp) * 10)
+		if temp < 0 {
+			t |= 0x8000
+		}
+		data = []uint8{uint8(h >> 8), uint8(h), uint8(t >> 8), uint8(t)}
+	}
+	return append(data, data[0]+data[1]+data[2]+data[3])
+}
+
+// dhtLevels returns the pin level for each read while CaptureDHT captures the frame.
+// Bits are encoded in the length of the high pulses: short for 0, long for 1.
+func dhtLevels(data []uint8) []bool {
+	levels := []bool{false} // Pull low to signal the start of the response.
+	pulse := func(low, high int) {
+		for i := 0; i < low; i++ {
+			levels = append(levels, false)
+		}
+		for i := 0; i < high; i++ {
+			levels = append(levels, true)
+		}
+	}
+	pulse(80, 80)
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<uint(bit)) != 0 {
+				pulse(50, 70)
+			} else {
+				pulse(50, 26)
+			}
+		}
+	}
+	return levels
+}
+
+// dhtTrace returns the length of each low and high pulse in the levels, as CaptureDHT records them.
+func dhtTrace(levels []bool) []int64 {
+	pulses := []int64{}
+	for i, l := range levels {
+		if i == 0 || l != levels[i-1] {
+			pulses = append(pulses, 0)
+		}
+		pulses[len(pulses)-1]++
+	}
+	return pulses
+}
+
+func abs(a float32) float32 {
+	if a >= 0 {
+		return a
+	}
+	return -a
+}
+
+func TestDecodeDHT(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  DHTModel
+		pulses []int64
+		temp   float32
+		humi   float32
+		ok     bool
+	}{
+		{"DHT22", ModelDHT22, dhtTrace(dhtLevels(dhtFrame(ModelDHT22, 21.5, 45.5))), 21.5, 45.5, true},
+		{"DHT22 negative", ModelDHT22, dhtTrace(dhtLevels(dhtFrame(ModelDHT22, -12.5, 80))), -12.5, 80, true},
+		{"AM2302", ModelAM2302, dhtTrace(dhtLevels(dhtFrame(ModelAM2302, 35, 99.5))), 35, 99.5, true},
+		{"AM2302 negative", ModelAM2302, dhtTrace(dhtLevels(dhtFrame(ModelAM2302, -0.5, 60))), -0.5, 60, true},
+		{"DHT11", ModelDHT11, dhtTrace(dhtLevels(dhtFrame(ModelDHT11, 23, 40))), 23, 40, true},
+		{"DHT11 negative", ModelDHT11, dhtTrace(dhtLevels(dhtFrame(ModelDHT11, -2.5, 30))), -2.5, 30, true},
+		{"DHT11 as DHT22", ModelDHT22, dhtTrace(dhtLevels(dhtFrame(ModelDHT11, 23, 40))), 0, 0, false},
+		{"bad checksum", ModelDHT22, dhtTrace(dhtLevels(append(dhtFrame(ModelDHT22, 21.5, 45.5)[:4], 0x42))), 0, 0, false},
+		{"short frame", ModelDHT22, dhtTrace(dhtLevels(dhtFrame(ModelDHT22, 21.5, 45.5)))[:2+30*2], 0, 0, false},
+		{"only the response", ModelDHT22, []int64{81, 80}, 0, 0, false},
+		{"empty frame", ModelDHT22, dhtTrace(dhtLevels(make([]uint8, 5))), 0, 0, false},
+		{"humidity out of range", ModelDHT22, dhtTrace(dhtLevels(dhtFrame(ModelDHT22, 20, 120))), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp, humi, err := DecodeDHT(tt.model, tt.pulses)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if math.Abs(float64(temp-tt.temp)) > 0.01 || math.Abs(float64(humi-tt.humi)) > 0.01 {
+				t.Errorf("got %.1fC %.1f%%, want %.1fC %.1f%%", temp, humi, tt.temp, tt.humi)
+			}
+		})
+	}
+}
+
+func TestDecodeDHTCorrupted(t *testing.T) {
+	levels := dhtLevels(dhtFrame(ModelDHT22, 21.5, 45.5))
+	pulses := dhtTrace(levels)
+	// A 0 bit of the temp stretched into a 1.
+	for i := 3 + 2*16; i < 3+2*32; i += 2 {
+		if pulses[i] < 50 {
+			pulses[i] = 70
+			break
+		}
+	}
+	if _, _, err := DecodeDHT(ModelDHT22, pulses); err == nil {
+		t.Error("flipped bit passed the checksum")
+	}
+}
+
+func TestFakeDHT(t *testing.T) {
+	for _, model := range []DHTModel{ModelDHT22, ModelDHT11, ModelAM2302} {
+		pin := gpio.NewFake().FakePin(4)
+		FakeDHT(pin, model)
+		d := &DHT{Pin: pin, Model: model}
+		tr, err := d.Read(false)
+		if err != nil {
+			t.Fatalf("%s: %s", model, err)
+		}
+		if tr.Temp != 20 || tr.Humi != 20 {
+			t.Errorf("%s: got %.1fC %.1f%%, want 20C 20%%", model, tr.Temp, tr.Humi)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultW1Root is where the kernel w1-therm driver lists 1-wire devices.
+const DefaultW1Root = "/sys/bus/w1/devices"
+
+// DS18B20 is a 1-wire temp sensor read through the kernel w1-therm driver (dtoverlay=w1-gpio).
+// It has no humidity, so readings always have 0 humidity.
+type DS18B20 struct {
+	Path string // w1_slave file of the sensor.
+}
+
+// OpenDS18B20 finds the sensor with the given ID under root, or the first DS18B20 if id is empty.
+func OpenDS18B20(root, id string) (*DS18B20, error) {
+	if root == "" {
+		root = DefaultW1Root
+	}
+	if id == "" {
+		// DS18B20s have family code 28.
+		found, err := filepath.Glob(filepath.Join(root, "28-*"))
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no DS18B20 found in %s", root)
+		}
+		id = filepath.Base(found[0])
+	}
+	d := &DS18B20{Path: filepath.Join(root, id, "w1_slave")}
+	if _, err := ioutil.ReadFile(d.Path); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Read implements Thermometer. The driver answers with two lines, the first ending in the CRC check
+// and the second in the temp in thousandths of a degree:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func (d *DS18B20) Read(includeWait bool) (ThermalReading, error) {
+	data, err := ioutil.ReadFile(d.Path)
+	if err != nil {
+		return ThermalReading{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		return ThermalReading{}, fmt.Errorf("unexpected DS18B20 output %q", data)
+	}
+	if !strings.HasSuffix(lines[0], "YES") {
+		return ThermalReading{}, errors.New("DS18B20 reading failed its CRC check")
+	}
+	i := strings.LastIndex(lines[1], "t=")
+	if i < 0 {
+		return ThermalReading{}, fmt.Errorf("no temp in DS18B20 output %q", data)
+	}
+	milli, err := strconv.Atoi(lines[1][i+2:])
+	if err != nil {
+		return ThermalReading{}, fmt.Errorf("invalid DS18B20 temp: %s", err)
+	}
+	// 85C is the power on value, the sensor never finished a conversion.
+	if milli == 85000 {
+		return ThermalReading{}, errors.New("DS18B20 returned its power on value")
+	}
+	return ThermalReading{Temp: float32(milli) / 1000}, nil
+}
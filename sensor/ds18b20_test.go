@@ -0,0 +1,83 @@
+package sensor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// w1Tree creates a fake w1 devices dir with a w1_slave file for each sensor ID.
+func w1Tree(t *testing.T, slaves map[string]string) string {
+	root, err := ioutil.TempDir("", "w1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, data := range slaves {
+		if err := os.Mkdir(filepath.Join(root, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, id, "w1_slave"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDS18B20Read(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want float32
+		ok   bool
+	}{
+		{"good", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 23.125, true},
+		{"negative", "ec ff 4b 46 7f ff 0c 10 d4 : crc=d4 YES\nec ff 4b 46 7f ff 0c 10 d4 t=-1250\n", -1.25, true},
+		{"bad crc", "72 01 4b 46 7f ff 0e 10 57 : crc=12 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 0, false},
+		{"power on value", "50 05 4b 46 7f ff 0c 10 1c : crc=1c YES\n50 05 4b 46 7f ff 0c 10 1c t=85000\n", 0, false},
+		{"no temp", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57\n", 0, false},
+		{"one line", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := w1Tree(t, map[string]string{"28-000005e2fdc3": tt.data})
+			defer os.RemoveAll(root)
+			d, err := OpenDS18B20(root, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr, err := d.Read(false)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if tr.Temp != tt.want || tr.Humi != 0 {
+				t.Errorf("got %.3fC %.1f%%, want %.3fC 0%%", tr.Temp, tr.Humi, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenDS18B20(t *testing.T) {
+	root := w1Tree(t, map[string]string{
+		"10-000802b4d8a1": "", // A DS18S20, not a DS18B20.
+		"28-000005e2fdc3": "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n",
+		"28-000005e30a11": "ec ff 4b 46 7f ff 0c 10 d4 : crc=d4 YES\nec ff 4b 46 7f ff 0c 10 d4 t=-1250\n",
+	})
+	defer os.RemoveAll(root)
+
+	d, err := OpenDS18B20(root, "28-000005e30a11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, _ := d.Read(false); tr.Temp != -1.25 {
+		t.Errorf("opened by ID read %.3fC, want the -1.25C sensor", tr.Temp)
+	}
+	if _, err := OpenDS18B20(root, "28-000000000000"); err == nil {
+		t.Error("opened a sensor that isn't there")
+	}
+	empty := w1Tree(t, map[string]string{"10-000802b4d8a1": ""})
+	defer os.RemoveAll(empty)
+	if _, err := OpenDS18B20(empty, ""); err == nil {
+		t.Error("found a DS18B20 where there is none")
+	}
+}
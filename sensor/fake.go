@@ -0,0 +1,37 @@
+package sensor
+
+import "gitlab.com/lologarithm/refuge/gpio"
+
+// FakeDHT scripts the fake pin to answer every read of a DHT of the given model with 20C and 20% humidity.
+// The sensor starts answering when the reader pulls the pin low to request a reading.
+func FakeDHT(pin *gpio.FakePin, model DHTModel) {
+	frame := []uint8{0x00, 0xC8, 0x00, 0xC8, 0x90} // Tenths of the humidity and temp.
+	if model == ModelDHT11 {
+		frame = []uint8{20, 0, 20, 0, 40}
+	}
+
+	// Pulses are counted in reads of the pin. The first is the response, then one per bit:
+	// a low followed by a short high for 0 or a long high for 1.
+	pulse, read := 41, 0
+	pin.OnWrite = func(high bool) {
+		if !high {
+			pulse, read = 0, 0 // Start signal, answer with a new reading.
+		}
+	}
+	pin.OnRead = func() bool {
+		if pulse > 40 {
+			return false
+		}
+		low, high := 50, 26
+		if pulse == 0 {
+			low, high = 81, 80 // Pull low to signal the start of the response.
+		} else if frame[(pulse-1)/8]&(0x80>>uint((pulse-1)%8)) != 0 {
+			high = 70
+		}
+		read++
+		if read >= low+high {
+			pulse, read = pulse+1, 0
+		}
+		return read == 0 || read > low
+	}
+}
@@ -0,0 +1,163 @@
+package sensor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter smooths a series of values.
+type Filter interface {
+	// Add adds the next value and returns the filtered value.
+	Add(v float32) float32
+}
+
+// Filter kinds accepted by ParseFilter.
+const (
+	FilterNone   = "none"
+	FilterMedian = "median"
+	FilterEMA    = "ema"
+	FilterKalman = "kalman"
+)
+
+// FilterConfig selects a filter and its parameters.
+type FilterConfig struct {
+	Kind   string
+	Window int     // Median: number of values to take the median of.
+	Alpha  float32 // EMA: weight of each new value, 0-1.
+	Q, R   float32 // Kalman: process and measurement noise (variance, C^2).
+}
+
+// DefaultFilter takes the median of the last 3 readings, dropping single bad readings without lagging much.
+var DefaultFilter = FilterConfig{Kind: FilterMedian, Window: 3}
+
+// ParseFilter parses a filter with its optional parameters separated by ':'.
+// For example 'none', 'median:5', 'ema:0.3' or 'kalman:0.01:0.5'.
+func ParseFilter(spec string) (FilterConfig, error) {
+	parts := strings.Split(spec, ":")
+	params := make([]float64, len(parts)-1)
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 32)
+		if err != nil || v <= 0 {
+			return FilterConfig{}, fmt.Errorf("invalid filter parameter %q in %q", p, spec)
+		}
+		params[i] = v
+	}
+	param := func(i int, def float64) float64 {
+		if i < len(params) {
+			return params[i]
+		}
+		return def
+	}
+	switch parts[0] {
+	case "":
+		return DefaultFilter, nil
+	case FilterNone:
+		return FilterConfig{Kind: FilterNone}, nil
+	case FilterMedian:
+		window := int(param(0, 3))
+		if window < 1 {
+			return FilterConfig{}, fmt.Errorf("median window %g is under 1", param(0, 3))
+		}
+		return FilterConfig{Kind: FilterMedian, Window: window}, nil
+	case FilterEMA:
+		alpha := param(0, 0.3)
+		if alpha > 1 {
+			return FilterConfig{}, fmt.Errorf("ema weight %g is over 1", alpha)
+		}
+		return FilterConfig{Kind: FilterEMA, Alpha: float32(alpha)}, nil
+	case FilterKalman:
+		return FilterConfig{Kind: FilterKalman, Q: float32(param(0, 0.01)), R: float32(param(1, 0.5))}, nil
+	}
+	return FilterConfig{}, fmt.Errorf("unknown filter %q, use none, median, ema or kalman", parts[0])
+}
+
+func (c FilterConfig) String() string {
+	switch c.Kind {
+	case FilterMedian:
+		return fmt.Sprintf("%s:%d", c.Kind, c.Window)
+	case FilterEMA:
+		return fmt.Sprintf("%s:%g", c.Kind, c.Alpha)
+	case FilterKalman:
+		return fmt.Sprintf("%s:%g:%g", c.Kind, c.Q, c.R)
+	}
+	return FilterNone
+}
+
+// New creates an empty filter.
+func (c FilterConfig) New() Filter {
+	switch c.Kind {
+	case FilterMedian:
+		return &Median{Window: c.Window}
+	case FilterEMA:
+		return &EMA{Alpha: c.Alpha}
+	case FilterKalman:
+		return &Kalman{Q: c.Q, R: c.R}
+	}
+	return noFilter{}
+}
+
+type noFilter struct{}
+
+func (noFilter) Add(v float32) float32 { return v }
+
+// Median returns the median of the last Window values, which drops outliers instead of averaging them in.
+type Median struct {
+	Window int
+	values []float32
+}
+
+// Add implements Filter.
+func (m *Median) Add(v float32) float32 {
+	m.values = append(m.values, v)
+	if m.Window > 0 && len(m.values) > m.Window {
+		m.values = m.values[len(m.values)-m.Window:]
+	}
+	sorted := append([]float32{}, m.values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// EMA is an exponential moving average, each new value moves the average Alpha of the way towards it.
+type EMA struct {
+	Alpha float32
+	value float32
+	ready bool
+}
+
+// Add implements Filter.
+func (e *EMA) Add(v float32) float32 {
+	if !e.ready {
+		e.value, e.ready = v, true
+		return v
+	}
+	e.value += e.Alpha * (v - e.value)
+	return e.value
+}
+
+// Kalman is a one dimensional Kalman filter for a value that drifts slowly (process noise Q)
+// measured by a noisy sensor (measurement noise R). The lower Q is compared to R the smoother the output.
+type Kalman struct {
+	Q, R     float32
+	estimate float32
+	variance float32
+	ready    bool
+}
+
+// Add implements Filter.
+func (k *Kalman) Add(v float32) float32 {
+	if !k.ready {
+		k.estimate, k.variance, k.ready = v, k.R, true
+		return v
+	}
+	k.variance += k.Q
+	gain := k.variance / (k.variance + k.R)
+	k.estimate += gain * (v - k.estimate)
+	k.variance *= 1 - gain
+	return k.estimate
+}
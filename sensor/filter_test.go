@@ -0,0 +1,173 @@
+package sensor
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// near compares filter outputs, which are float32 arithmetic.
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 0.001
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		spec string
+		want FilterConfig
+		ok   bool
+	}{
+		{"", DefaultFilter, true},
+		{"none", FilterConfig{Kind: FilterNone}, true},
+		{"median", FilterConfig{Kind: FilterMedian, Window: 3}, true},
+		{"median:5", FilterConfig{Kind: FilterMedian, Window: 5}, true},
+		{"median:0.5", FilterConfig{}, false},
+		{"ema", FilterConfig{Kind: FilterEMA, Alpha: 0.3}, true},
+		{"ema:0.5", FilterConfig{Kind: FilterEMA, Alpha: 0.5}, true},
+		{"ema:2", FilterConfig{}, false},
+		{"kalman", FilterConfig{Kind: FilterKalman, Q: 0.01, R: 0.5}, true},
+		{"kalman:0.1:2", FilterConfig{Kind: FilterKalman, Q: 0.1, R: 2}, true},
+		{"kalman:-1", FilterConfig{}, false},
+		{"median:abc", FilterConfig{}, false},
+		{"average", FilterConfig{}, false},
+		{"Median", FilterConfig{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v, want ok %v", tt.spec, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.spec, got, tt.want)
+		}
+		// Specs with their parameters print back the same.
+		if tt.ok && strings.Contains(tt.spec, ":") && got.String() != tt.spec {
+			t.Errorf("%q: printed as %q", tt.spec, got.String())
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter FilterConfig
+		in     []float32
+		want   []float32
+	}{
+		{
+			name:   "none",
+			filter: FilterConfig{Kind: FilterNone},
+			in:     []float32{20, 45, 20.5},
+			want:   []float32{20, 45, 20.5},
+		},
+		{
+			// Until the window is full the median is of what there is so far.
+			name:   "median window fill",
+			filter: FilterConfig{Kind: FilterMedian, Window: 3},
+			in:     []float32{20, 21, 23, 22},
+			want:   []float32{20, 20.5, 21, 22},
+		},
+		{
+			name:   "median outlier",
+			filter: FilterConfig{Kind: FilterMedian, Window: 3},
+			in:     []float32{20, 20.2, 85, 20.4, 20.6},
+			want:   []float32{20, 20.1, 20.2, 20.4, 20.6},
+		},
+		{
+			// Two bad readings in a row make it through a window of 3, but not 5.
+			name:   "median wider window",
+			filter: FilterConfig{Kind: FilterMedian, Window: 5},
+			in:     []float32{20, 20, 20, -40, -40, 20},
+			want:   []float32{20, 20, 20, 20, 20, 20},
+		},
+		{
+			name:   "ema",
+			filter: FilterConfig{Kind: FilterEMA, Alpha: 0.5},
+			in:     []float32{20, 22, 22, 22},
+			want:   []float32{20, 21, 21.5, 21.75},
+		},
+		{
+			name:   "ema outlier",
+			filter: FilterConfig{Kind: FilterEMA, Alpha: 0.1},
+			in:     []float32{20, 30, 20},
+			want:   []float32{20, 21, 20.9},
+		},
+		{
+			// The variance starts at R, so the first gain is (R+Q)/(2R+Q).
+			name:   "kalman",
+			filter: FilterConfig{Kind: FilterKalman, Q: 0, R: 1},
+			in:     []float32{20, 22, 22},
+			want:   []float32{20, 21, 21.3333},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter.New()
+			for i, v := range tt.in {
+				if got := f.Add(v); !near(got, tt.want[i]) {
+					t.Fatalf("value %d: got %.4f, want %.4f", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKalmanSmooths(t *testing.T) {
+	// A steady 20C read with +-1C of noise, the output stays much closer than the readings.
+	k := FilterConfig{Kind: FilterKalman, Q: 0.001, R: 1}.New()
+	var got float32
+	for i := 0; i < 50; i++ {
+		noise := float32(1)
+		if i%2 == 0 {
+			noise = -1
+		}
+		got = k.Add(20 + noise)
+	}
+	if !(got > 19.8 && got < 20.2) {
+		t.Errorf("got %.2f after 50 noisy readings of 20C", got)
+	}
+}
+
+func TestCalibrationApply(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  Calibration
+		in   ThermalReading
+		want ThermalReading
+	}{
+		{"zero value", Calibration{}, ThermalReading{Temp: 21, Humi: 40, Pressure: 1000}, ThermalReading{Temp: 21, Humi: 40, Pressure: 1000}},
+		{"offset", Calibration{TempOffset: -1.5, HumiOffset: 5}, ThermalReading{Temp: 21, Humi: 40}, ThermalReading{Temp: 19.5, Humi: 45}},
+		{"scale", Calibration{TempScale: 1.1, HumiScale: 0.9}, ThermalReading{Temp: 20, Humi: 50}, ThermalReading{Temp: 22, Humi: 45}},
+		{"scale then offset", Calibration{TempScale: 0.5, TempOffset: 1}, ThermalReading{Temp: 20}, ThermalReading{Temp: 11}},
+		{"negative temp", Calibration{TempScale: 2}, ThermalReading{Temp: -5}, ThermalReading{Temp: -10}},
+		{"humidity over 100", Calibration{HumiOffset: 10}, ThermalReading{Humi: 95}, ThermalReading{Humi: 100}},
+		{"humidity under 0", Calibration{HumiOffset: -10}, ThermalReading{Humi: 5}, ThermalReading{Humi: 0}},
+	}
+	for _, tt := range tests {
+		got := tt.cal.Apply(tt.in)
+		if !near(got.Temp, tt.want.Temp) || !near(got.Humi, tt.want.Humi) || got.Pressure != tt.want.Pressure {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline(Calibration{TempOffset: -1}, FilterConfig{Kind: FilterMedian, Window: 3})
+	for _, raw := range []float32{21, 21, 86} {
+		p.Add(ThermalReading{Temp: raw, Humi: 40})
+	}
+	// Calibrated before filtering, and the outlier is dropped.
+	if got := p.Add(ThermalReading{Temp: 21.5, Humi: 40}); !near(got.Temp, 20.5) {
+		t.Fatalf("got %.2fC, want 20.5C", got.Temp)
+	}
+
+	// A new calibration starts the filters over, the old readings were calibrated differently.
+	p.SetCalibration(Calibration{TempOffset: 1})
+	if got := p.Add(ThermalReading{Temp: 21, Humi: 40}); !near(got.Temp, 22) || p.Calibration().TempOffset != 1 {
+		t.Fatalf("got %.2fC after recalibrating, want 22C", got.Temp)
+	}
+	if p.Filter().Window != 3 {
+		t.Errorf("filter changed to %s", p.Filter())
+	}
+}
@@ -0,0 +1,23 @@
+package sensor
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// i2cSlave is the I2C_SLAVE ioctl from include/uapi/linux/i2c-dev.h, it sets the address reads and writes go to.
+const i2cSlave = 0x0703
+
+// openI2C opens the i2c bus device and points it at the device with the given address.
+func openI2C(bus string, addr uint16) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(addr)); errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package sensor
+
+import (
+	"errors"
+	"io"
+)
+
+// openI2C is only supported on linux.
+func openI2C(bus string, addr uint16) (io.ReadWriteCloser, error) {
+	return nil, errors.New("i2c devices are only supported on linux")
+}
@@ -1,38 +1,121 @@
 package sensor
 
 import (
-	"fmt"
+	"sync"
 	"time"
 
-	rpio "github.com/stianeikeland/go-rpio"
+	"gitlab.com/lologarithm/refuge/gpio"
 )
 
-// Motion accepts a pin to read on and a stream to write on.
-// Streams the int64 unix time of a motion event.
-// Close the stream to stop reading
-func Motion(p int, stream chan int64) {
-	pin := rpio.Pin(p)
-	lr := rpio.Low      // last reading
-	ltime := time.Now() // last time motion was detected
+// Defaults for a MotionSource.
+const (
+	DefaultDebounce   = 50 * time.Millisecond
+	DefaultMotionHold = 30 * time.Second
+)
+
+// motionPoll is how often the latched edges of the pin are checked. Edges are latched by the gpio backend,
+// so pulses shorter than this are still seen.
+const motionPoll = 10 * time.Millisecond
+
+// MotionEvent is motion starting or ending.
+type MotionEvent struct {
+	Motion bool      // true when motion started, false when it ended.
+	Time   time.Time // When the sensor pin went high/low, after debouncing.
+}
+
+// MotionSource watches a motion sensor pin, high while there is motion, for edges.
+// The pin has to hold a level for the debounce time before it counts, so noise doesn't cause churn.
+// Motion only ends once the pin has been low for the hold time, so a sensor retriggering within it
+// extends the motion instead of starting new motion.
+type MotionSource struct {
+	pin      gpio.Pin
+	debounce time.Duration
+	hold     time.Duration
+	events   chan MotionEvent
+	done     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewMotionSource starts watching the pin. Call Close to stop.
+func NewMotionSource(pin gpio.Pin, debounce, hold time.Duration) *MotionSource {
+	m := &MotionSource{
+		pin:      pin,
+		debounce: debounce,
+		hold:     hold,
+		events:   make(chan MotionEvent, 16),
+		done:     make(chan struct{}),
+	}
+	pin.Input()
+	pin.Pull(gpio.PullDown)
+	pin.Detect(gpio.AnyEdge)
+	m.wg.Add(1)
+	go m.watch()
+	return m
+}
+
+// Events returns the motion events. It is closed once the source is closed.
+func (m *MotionSource) Events() <-chan MotionEvent {
+	return m.events
+}
+
+// Close stops watching the pin and closes the events channel. It is safe to call more than once.
+func (m *MotionSource) Close() {
+	m.once.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+		m.pin.Detect(gpio.NoEdge)
+	})
+}
+
+func (m *MotionSource) watch() {
+	defer m.wg.Done()
+	defer close(m.events)
+	ticker := time.NewTicker(motionPoll)
+	defer ticker.Stop()
+
+	motion := false     // Motion started and hasn't ended.
+	stable := false     // Debounced level of the pin.
+	level := false      // Level the pin is settling on.
+	since := time.Now() // When the pin changed to level.
+	var ended time.Time // When the pin went low, motion ends once it stays low for the hold time.
 	for {
-		v := pin.Read()
-		if lr != v {
-			lr = v
-			if lr == rpio.High {
-				ltime = time.Now()
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			high := m.pin.Read()
+			// An edge without a level change is a pulse shorter than the poll, it still restarts the debounce.
+			if m.pin.EdgeDetected() || high != level {
+				level, since = high, now
 			}
-			fmt.Printf("Reading changed: %d, last motion: %s\n", lr, ltime.Format("Jan _2 15:04:05 MST"))
-			select {
-			case stream <- ltime.Unix():
-			default:
-				return // bad, exit
+			if level != stable && now.Sub(since) >= m.debounce {
+				stable = level
+				if !stable {
+					ended = since
+				} else if !motion {
+					motion = true
+					if !m.send(MotionEvent{Motion: true, Time: since}) {
+						return
+					}
+				}
+			}
+			if motion && !stable && now.Sub(ended) >= m.hold {
+				motion = false
+				if !m.send(MotionEvent{Motion: false, Time: ended}) {
+					return
+				}
 			}
 		}
-		time.Sleep(time.Second) // read from motion sensor once per second
 	}
 }
 
-// ReadMotion will check if the pin has recently seen motion.
-func ReadMotion(pin rpio.Pin) bool {
-	return pin.Read() == rpio.High
+// send waits for room in the events channel, returns false if the source was closed while waiting.
+func (m *MotionSource) send(ev MotionEvent) bool {
+	select {
+	case m.events <- ev:
+		return true
+	case <-m.done:
+		return false
+	}
 }
@@ -0,0 +1,146 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/lologarithm/refuge/gpio"
+)
+
+const (
+	testDebounce = 30 * time.Millisecond
+	testHold     = 200 * time.Millisecond
+)
+
+func testMotionSource() (*MotionSource, *gpio.FakePin) {
+	pin := gpio.NewFake().FakePin(17)
+	return NewMotionSource(pin, testDebounce, testHold), pin
+}
+
+// nextEvent waits for the next event, failing if it isn't the wanted one.
+func nextEvent(t *testing.T, m *MotionSource, motion bool, within time.Duration) MotionEvent {
+	t.Helper()
+	select {
+	case ev := <-m.Events():
+		if ev.Motion != motion {
+			t.Fatalf("got motion %v, want %v", ev.Motion, motion)
+		}
+		return ev
+	case <-time.After(within):
+		t.Fatalf("no motion %v event within %s", motion, within)
+	}
+	return MotionEvent{}
+}
+
+// noEvent fails if there is an event in the next d.
+func noEvent(t *testing.T, m *MotionSource, d time.Duration) {
+	t.Helper()
+	select {
+	case ev := <-m.Events():
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(d):
+	}
+}
+
+func TestMotionStartEnd(t *testing.T) {
+	m, pin := testMotionSource()
+	defer m.Close()
+	if pin.IsOutput() || pin.Pulled() != gpio.PullDown {
+		t.Fatal("pin not set up as a pulled down input")
+	}
+
+	high := time.Now()
+	pin.Set(true)
+	start := nextEvent(t, m, true, time.Second)
+	if start.Time.Before(high) || start.Time.Sub(high) > testDebounce {
+		t.Errorf("motion started at %s, %s after the pin went high", start.Time, start.Time.Sub(high))
+	}
+
+	low := time.Now()
+	pin.Set(false)
+	end := nextEvent(t, m, false, time.Second)
+	if since := time.Since(low); since < testHold {
+		t.Errorf("motion ended %s after the pin went low, before the hold", since)
+	}
+	// The end is when the pin went low, not when the hold ran out.
+	if end.Time.Before(low) || end.Time.Sub(low) > testDebounce {
+		t.Errorf("motion ended at %s, %s after the pin went low", end.Time, end.Time.Sub(low))
+	}
+}
+
+func TestMotionDebounce(t *testing.T) {
+	tests := []struct {
+		name   string
+		toggle func(pin *gpio.FakePin)
+	}{
+		{"short glitch", func(pin *gpio.FakePin) {
+			pin.Set(true)
+			time.Sleep(testDebounce / 3)
+			pin.Set(false)
+		}},
+		{"pulse between polls", func(pin *gpio.FakePin) {
+			pin.Set(true)
+			pin.Set(false)
+		}},
+		{"chatter", func(pin *gpio.FakePin) {
+			for i := 0; i < 5; i++ {
+				pin.Set(true)
+				time.Sleep(testDebounce / 4)
+				pin.Set(false)
+				time.Sleep(testDebounce / 4)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, pin := testMotionSource()
+			defer m.Close()
+			tt.toggle(pin)
+			noEvent(t, m, 3*testDebounce)
+
+			// A steady level afterwards still counts.
+			pin.Set(true)
+			nextEvent(t, m, true, time.Second)
+		})
+	}
+}
+
+func TestMotionRetrigger(t *testing.T) {
+	m, pin := testMotionSource()
+	defer m.Close()
+	pin.Set(true)
+	start := nextEvent(t, m, true, time.Second)
+
+	// Motion resumes within the hold, it's still the same motion.
+	pin.Set(false)
+	time.Sleep(testHold / 2)
+	pin.Set(true)
+	noEvent(t, m, testHold+testHold/2)
+
+	// A glitch low while there is motion doesn't start the hold either.
+	pin.Set(false)
+	time.Sleep(testDebounce / 3)
+	pin.Set(true)
+	noEvent(t, m, testHold+testHold/2)
+
+	low := time.Now()
+	pin.Set(false)
+	end := nextEvent(t, m, false, time.Second)
+	if end.Time.Before(low) || !end.Time.After(start.Time) {
+		t.Errorf("motion ended at %s, want after the last time the pin went low at %s", end.Time, low)
+	}
+}
+
+func TestMotionClose(t *testing.T) {
+	m, pin := testMotionSource()
+	pin.Set(true)
+	nextEvent(t, m, true, time.Second)
+	m.Close()
+	m.Close()
+	if _, ok := <-m.Events(); ok {
+		t.Error("events not closed after Close")
+	}
+	if pin.EdgeDetected() {
+		t.Error("edges still detected after Close")
+	}
+}
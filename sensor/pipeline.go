@@ -0,0 +1,73 @@
+package sensor
+
+// Calibration corrects the raw readings of a sensor: raw*Scale + Offset.
+// A scale of 0 is treated as 1, so the zero value leaves readings as they are.
+type Calibration struct {
+	TempOffset float32
+	TempScale  float32
+	HumiOffset float32
+	HumiScale  float32
+}
+
+// Apply returns the corrected reading. Humidity stays within 0-100%.
+func (c Calibration) Apply(r ThermalReading) ThermalReading {
+	r.Temp = r.Temp*scale(c.TempScale) + c.TempOffset
+	r.Humi = r.Humi*scale(c.HumiScale) + c.HumiOffset
+	if r.Humi < 0 {
+		r.Humi = 0
+	} else if r.Humi > 100 {
+		r.Humi = 100
+	}
+	return r
+}
+
+func scale(s float32) float32 {
+	if s == 0 {
+		return 1
+	}
+	return s
+}
+
+// Pipeline calibrates the readings of a sensor and then smooths them with a filter.
+// Temp and humidity are filtered separately, pressure is passed through as is.
+type Pipeline struct {
+	cal        Calibration
+	filter     FilterConfig
+	temp, humi Filter
+}
+
+// NewPipeline creates a pipeline with the given calibration and filter.
+func NewPipeline(cal Calibration, filter FilterConfig) *Pipeline {
+	p := &Pipeline{cal: cal, filter: filter}
+	p.Reset()
+	return p
+}
+
+// Add calibrates and filters the raw reading.
+func (p *Pipeline) Add(raw ThermalReading) ThermalReading {
+	r := p.cal.Apply(raw)
+	r.Temp = p.temp.Add(r.Temp)
+	r.Humi = p.humi.Add(r.Humi)
+	return r
+}
+
+// Reset empties the filters, so the next reading starts them over.
+func (p *Pipeline) Reset() {
+	p.temp, p.humi = p.filter.New(), p.filter.New()
+}
+
+// Calibration returns the calibration applied to readings.
+func (p *Pipeline) Calibration() Calibration {
+	return p.cal
+}
+
+// SetCalibration replaces the calibration. The filters are reset, their history was calibrated differently.
+func (p *Pipeline) SetCalibration(cal Calibration) {
+	p.cal = cal
+	p.Reset()
+}
+
+// Filter returns the filter applied to readings.
+func (p *Pipeline) Filter() FilterConfig {
+	return p.filter
+}
@@ -0,0 +1,148 @@
+package sensor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is one line of a sensor recording: a thermal reading or a motion event.
+// Recordings are files of JSON records, one per line, in the order they happened.
+type Record struct {
+	Time    time.Time
+	Reading *ThermalReading `json:",omitempty"`
+	Motion  *MotionEvent    `json:",omitempty"`
+}
+
+// MotionEvents is a source of motion events, like a MotionSource or one being recorded.
+type MotionEvents interface {
+	// Events returns the motion events. It is closed once the source is closed.
+	Events() <-chan MotionEvent
+	Close()
+}
+
+// Recorder appends records to a recording file. It is safe to use from several goroutines.
+type Recorder struct {
+	lock sync.Mutex
+	f    *os.File
+}
+
+// OpenRecorder opens the recording file, appending to it if it already exists.
+func OpenRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Add appends the record. Failures are only printed, a broken recording shouldn't stop the device.
+func (r *Recorder) Add(rec Record) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		fmt.Printf("Failed to encode record: %s\n", err)
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, err := r.f.Write(append(data, '\n')); err != nil {
+		fmt.Printf("Failed to write record to %s: %s\n", r.f.Name(), err)
+	}
+}
+
+// Close closes the recording file.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// RecordThermometer records every good reading of the thermometer.
+func RecordThermometer(t Thermometer, rec *Recorder) Thermometer {
+	return &recordedThermometer{t: t, rec: rec}
+}
+
+type recordedThermometer struct {
+	t   Thermometer
+	rec *Recorder
+}
+
+func (r *recordedThermometer) Read(includeWait bool) (ThermalReading, error) {
+	tr, err := r.t.Read(includeWait)
+	if err == nil {
+		now := time.Now()
+		tr.Time = now
+		r.rec.Add(Record{Time: now, Reading: &tr})
+	}
+	return tr, err
+}
+
+// RecordMotion records every event of the motion source as it is passed on.
+func RecordMotion(src MotionEvents, rec *Recorder) MotionEvents {
+	r := &recordedMotion{src: src, events: make(chan MotionEvent, 16), done: make(chan struct{})}
+	go func() {
+		defer close(r.events)
+		for ev := range src.Events() {
+			ev := ev
+			rec.Add(Record{Time: ev.Time, Motion: &ev})
+			select {
+			case r.events <- ev:
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+type recordedMotion struct {
+	src    MotionEvents
+	events chan MotionEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (r *recordedMotion) Events() <-chan MotionEvent { return r.events }
+
+// Close closes the source and stops passing on its events, even if nothing is reading them.
+func (r *recordedMotion) Close() {
+	r.once.Do(func() {
+		close(r.done)
+		r.src.Close()
+	})
+}
+
+// LoadRecording reads all the records of a recording file.
+func LoadRecording(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		rec := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", path, line, err)
+		}
+		if rec.Reading == nil && rec.Motion == nil {
+			return nil, fmt.Errorf("%s line %d: record has no reading or motion", path, line)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s has no records", path)
+	}
+	// Motion events are recorded when they are passed on, which can be after a later reading.
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
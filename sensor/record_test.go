@@ -0,0 +1,58 @@
+package sensor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testMotion is a MotionEvents whose events are sent by the test.
+type testMotion struct {
+	events chan MotionEvent
+}
+
+func (m *testMotion) Events() <-chan MotionEvent { return m.events }
+func (m *testMotion) Close()                     { close(m.events) }
+
+func testRecorder(t *testing.T) (*Recorder, string) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rec.json")
+	rec, err := OpenRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec, path
+}
+
+func TestRecordMotionClose(t *testing.T) {
+	rec, path := testRecorder(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer rec.Close()
+
+	src := &testMotion{events: make(chan MotionEvent)}
+	m := RecordMotion(src, rec)
+	// Fill the events channel and block the recorder on one more, nothing is reading them.
+	start := time.Now()
+	for i := 0; i < 17; i++ {
+		src.events <- MotionEvent{Motion: i%2 == 0, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+
+	m.Close()
+	m.Close()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-m.Events():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events not closed after Close")
+		}
+	}
+}